@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/jsonpatch"
 	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"mime"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -18,12 +25,14 @@ func (app *application) HealthCheckHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) createBlogHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		ID        int64     `json:"id"`
-		CreatedAt time.Time `json:"-"`
-		Title     string    `json:"title"`
-		Body      string    `json:"body"`
-		Category  []string  `json:"category"`
-		Version   int32     `json:"version,omitempty"`
+		ID        int64      `json:"id"`
+		CreatedAt time.Time  `json:"-"`
+		Title     string     `json:"title"`
+		Body      string     `json:"body"`
+		Category  []string   `json:"category"`
+		Version   int32      `json:"version,omitempty"`
+		Status    string     `json:"status"`
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -32,10 +41,20 @@ func (app *application) createBlogHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	user := app.contextGetUser(r)
+
 	blog := &data.Blog{
-		Title:    input.Title,
-		Body:     input.Body,
-		Category: input.Category,
+		Title:     input.Title,
+		Body:      input.Body,
+		Category:  input.Category,
+		Author:    &data.Author{ID: user.ID, Name: user.Name},
+		Status:    input.Status,
+		PublishAt: input.PublishAt,
+	}
+
+	// New blogs stay private until their author publishes them.
+	if blog.Status == "" {
+		blog.Status = data.StatusDraft
 	}
 
 	v := validator.New()
@@ -45,8 +64,13 @@ func (app *application) createBlogHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.model.Blog.Insert(blog)
+	err = app.model.Blog.Insert(r.Context(), blog)
 	if err != nil {
+		var constraintErr *data.ConstraintError
+		if errors.As(err, &constraintErr) {
+			app.failedValidationResponse(w, r, constraintErr.Errors())
+			return
+		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
@@ -68,7 +92,7 @@ func (app *application) showBlogHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	blog, err := app.model.Blog.Get(id)
+	blog, err := app.model.Blog.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
@@ -78,21 +102,33 @@ func (app *application) showBlogHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"blog": blog}, nil)
+	ok, err := app.canViewBlog(r.Context(), app.contextGetUser(r), blog)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-}
 
-func (app *application) deleteBlogHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readParamID(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.versionETag(blog.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blog": blog}, headers)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
+}
 
-	err = app.model.Blog.Delete(id)
+// showBlogBySlugHandler shows the blog with the given slug. Slugs the blog had
+// before a title change redirect to its current slug.
+func (app *application) showBlogBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	blog, err := app.model.Blog.GetBySlug(r.Context(), slug)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
@@ -102,22 +138,41 @@ func (app *application) deleteBlogHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "blogs successfully deleted"}, nil)
+	ok, err := app.canViewBlog(r.Context(), app.contextGetUser(r), blog)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if slug != blog.Slug {
+		http.Redirect(w, r, "/v1/blogs/by-slug/"+url.PathEscape(blog.Slug), http.StatusMovedPermanently)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.versionETag(blog.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blog": blog}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) updateBlogHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) deleteBlogHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readParamID(r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	blog, err := app.model.Blog.Get(id)
+	blog, err := app.model.Blog.Get(r.Context(), id)
 	if err != nil {
-		if errors.Is(data.ErrRecordNotFound, err) {
+		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
 			return
 		}
@@ -125,13 +180,48 @@ func (app *application) updateBlogHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	ok, err := app.canModifyBlog(r.Context(), app.contextGetUser(r), blog)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.model.Blog.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "blogs successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateBlogHandler(w http.ResponseWriter, r *http.Request) {
+	blog, ok := app.readBlogForUpdate(w, r)
+	if !ok {
+		return
+	}
+
 	var input struct {
-		Title    *string  `json:"title"`
-		Body     *string  `json:"body"`
-		Category []string `json:"category"`
+		Title     *string    `json:"title"`
+		Body      *string    `json:"body"`
+		Category  []string   `json:"category"`
+		Status    *string    `json:"status"`
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
-	err = app.readJSON(w, r, &input)
+	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -149,6 +239,145 @@ func (app *application) updateBlogHandler(w http.ResponseWriter, r *http.Request
 		blog.Category = input.Category
 	}
 
+	if input.Status != nil {
+		blog.Status = *input.Status
+	}
+
+	if input.PublishAt != nil {
+		blog.PublishAt = input.PublishAt
+	}
+
+	app.saveBlog(w, r, blog)
+}
+
+// blogPatchDocument is the part of a blog that PATCH requests operate on.
+// Patches touching any other member are rejected.
+type blogPatchDocument struct {
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Category  []string   `json:"category"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+func (app *application) patchBlogHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json-patch+json") {
+		app.unsupportedPatchMediaTypeResponse(w, r)
+		return
+	}
+
+	blog, ok := app.readBlogForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	patch, err := app.readBody(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	doc, err := json.Marshal(blogPatchDocument{
+		Title:     blog.Title,
+		Body:      blog.Body,
+		Category:  blog.Category,
+		Status:    blog.Status,
+		PublishAt: blog.PublishAt,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		doc, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case "application/json-patch+json":
+		p, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		doc, err = p.Apply(doc)
+		if err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				app.patchTestFailedResponse(w, r, err)
+				return
+			}
+			app.unprocessablePatchResponse(w, r, err)
+			return
+		}
+	}
+
+	var patched blogPatchDocument
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&patched)
+	if err != nil {
+		app.unprocessablePatchResponse(w, r, err)
+		return
+	}
+
+	blog.Title = patched.Title
+	blog.Body = patched.Body
+	blog.Category = patched.Category
+	blog.Status = patched.Status
+	blog.PublishAt = patched.PublishAt
+
+	app.saveBlog(w, r, blog)
+}
+
+// readBlogForUpdate loads the blog from the id parameter and checks that the
+// user may modify it and that the If-Match precondition holds. If it returns
+// false, the error response has already been sent.
+func (app *application) readBlogForUpdate(w http.ResponseWriter, r *http.Request) (*data.Blog, bool) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	blog, err := app.model.Blog.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	ok, err := app.canModifyBlog(r.Context(), app.contextGetUser(r), blog)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	// The client sends the ETag it got from showBlogHandler, so an edit made
+	// on top of an outdated copy is refused instead of overwriting a newer one.
+	if !app.ifMatch(r, app.versionETag(blog.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return nil, false
+	}
+
+	return blog, true
+}
+
+// saveBlog validates the modified blog, stores it and writes it to the response.
+func (app *application) saveBlog(w http.ResponseWriter, r *http.Request, blog *data.Blog) {
 	v := validator.New()
 
 	if data.ValidateBlog(v, blog); !v.Valid() {
@@ -156,23 +385,34 @@ func (app *application) updateBlogHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.model.Blog.Update(blog)
+	// Update only succeeds if the version is still the one we read,
+	// so a concurrent edit since then is reported as a conflict.
+	err := app.model.Blog.Update(r.Context(), blog)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.failedValidationResponse(w, r, constraintErr.Errors())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"blog": blog}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", app.versionETag(blog.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blog": blog}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
 }
 
 func (app *application) listBlogHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title    string
-		Category []string
+		data.BlogCriteria
 		data.Filter
 	}
 
@@ -183,18 +423,72 @@ func (app *application) listBlogHandler(w http.ResponseWriter, r *http.Request)
 
 	input.Category = app.readCSV(query, "category", []string{})
 
+	input.AuthorID = int64(app.readInt(query, "author", 0, v))
+	v.Check(input.AuthorID >= 0, "author", "must not be negative")
+
+	input.Status = app.readString(query, "status", data.StatusPublished)
+	v.Check(validator.In(input.Status, data.BlogStatuses...), "status", "invalid status value")
+
+	input.Query = app.readString(query, "q", "")
+
+	input.Language = app.readString(query, "lang", "simple")
+	v.Check(validator.In(input.Language, data.SearchLanguages...), "lang", "invalid lang value")
+
 	input.Filter.Page = app.readInt(query, "page", 1, v)
 	input.Filter.PageSize = app.readInt(query, "page_size", 20, v)
-	input.Filter.Sort = app.readString(query, "sort", "id")
 
 	input.Filter.SortSafeList = []string{"id", "title", "-id", "-title"}
 
+	// Passing a cursor, even an empty one, switches to keyset paging, which
+	// only counts the records when asked to.
+	input.Filter.Keyset = query.Has("cursor")
+	input.Filter.Cursor = query.Get("cursor")
+	input.Filter.CursorKey = []byte(app.config.cursor.secret)
+	input.Filter.Count = app.readBool(query, "count", false, v)
+
+	// Search results are ordered by relevance unless asked otherwise. The
+	// rank can't be used as a cursor key, so keyset pages stay sorted by id.
+	if input.Query != "" && !input.Filter.Keyset {
+		input.Filter.Sort = app.readString(query, "sort", "-rank")
+		input.Filter.SortSafeList = append(input.Filter.SortSafeList, "-rank")
+	} else {
+		input.Filter.Sort = app.readString(query, "sort", "id")
+	}
+
 	if data.ValidateFilter(v, input.Filter); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	blogs, metadata, err := app.model.Blog.GetAll(input.Title, input.Category, input.Filter)
+	// Everyone can list published blogs, but the other states are only
+	// listed for their author, which defaults to the current user.
+	if input.Status != data.StatusPublished {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		if input.AuthorID == 0 {
+			input.AuthorID = user.ID
+		}
+
+		if input.AuthorID != user.ID {
+			admin, err := app.isAdmin(r.Context(), user)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if !admin {
+				app.notPermittedResponse(w, r)
+				return
+			}
+		}
+	}
+
+	blogs, metadata, err := app.model.Blog.GetAll(r.Context(), input.BlogCriteria, input.Filter)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
@@ -204,8 +498,43 @@ func (app *application) listBlogHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"blogs": blogs, "metadata": metadata}, nil)
+	headers := app.paginationLinks(r, &metadata)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blogs": blogs, "metadata": metadata}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// canModifyBlog reports whether the user may update or delete the blog,
+// which is allowed for its author and for admins.
+func (app *application) canModifyBlog(ctx context.Context, user *data.User, blog *data.Blog) (bool, error) {
+	if blog.IsAuthor(user.ID) {
+		return true, nil
+	}
+
+	return app.isAdmin(ctx, user)
+}
+
+// canViewBlog reports whether the user may read the blog. Published blogs
+// are public, the others are only visible to their author and to admins.
+func (app *application) canViewBlog(ctx context.Context, user *data.User, blog *data.Blog) (bool, error) {
+	if blog.Status == data.StatusPublished {
+		return true, nil
+	}
+
+	if user.IsAnonymous() {
+		return false, nil
+	}
+
+	return app.canModifyBlog(ctx, user, blog)
+}
+
+func (app *application) isAdmin(ctx context.Context, user *data.User) (bool, error) {
+	permissions, err := app.model.Permission.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include(data.PermissionAdmin), nil
+}
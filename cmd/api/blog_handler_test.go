@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"github.com/3n0ugh/BasedWeb/internal/data"
 	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	"github.com/3n0ugh/BasedWeb/internal/mailer"
 	"github.com/julienschmidt/httprouter"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -39,10 +44,33 @@ type testCasesBlog struct {
 
 func NewTestApplication(model data.Model) *application {
 	return &application{
-		model: model,
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		model:  model,
+		mailer: mailer.New(&sentMail{}, "BasedWeb <no-reply@basedweb.local>"),
 	}
 }
 
+// sentMail is a mail backend recording the recipients of the emails sent.
+type sentMail struct {
+	mu sync.Mutex
+	to []string
+}
+
+func (m *sentMail) Send(from string, to []string, msg []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.to = append(m.to, to...)
+	return nil
+}
+
+func (m *sentMail) recipients() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.to...)
+}
+
 func NewRequestWithContext(method string, url string, bodyJSON []byte, p httprouter.Params) *http.Request {
 	body := strings.NewReader(string(bodyJSON))
 
@@ -50,6 +78,7 @@ func NewRequestWithContext(method string, url string, bodyJSON []byte, p httprou
 
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, httprouter.ParamsKey, p)
+	ctx = context.WithValue(ctx, userContextKey, mock.User)
 	r = r.WithContext(ctx)
 
 	return r
@@ -111,12 +140,15 @@ func TestCreateBlogHandler(t *testing.T) {
 			reqBody:      reqBody,
 			envelopeName: "blog",
 			wantBody: data.Blog{
-				ID:        11,
+				ID:        2,
 				CreatedAt: time.Now(),
 				Title:     "gRPC in Go!",
+				Slug:      "grpc-in-go-2",
 				Body:      "I do not know yet",
 				Category:  []string{"Golang", "Network"},
-				Version:   3,
+				Author:    &data.Author{ID: mock.User.ID, Name: mock.User.Name},
+				Status:    data.StatusDraft,
+				Version:   1,
 			}},
 		{name: "Empty Request", urlPath: wantUrl, wantCode: http.StatusUnprocessableEntity,
 			envelopeName: "error",
@@ -134,7 +166,17 @@ func TestCreateBlogHandler(t *testing.T) {
 				Category: []string{"Golang", "Network"},
 			},
 			wantBody: testCasesBlog{
-				Title: "must not be more than 80 bytes long",
+				Title: "must not be more than 70 characters long",
+			}},
+		{name: "Short Title", urlPath: wantUrl, wantCode: http.StatusUnprocessableEntity,
+			envelopeName: "error",
+			reqBody: testBlog{
+				Title:    "Go",
+				Body:     "I do not know yet",
+				Category: []string{"Golang", "Network"},
+			},
+			wantBody: testCasesBlog{
+				Title: "must be at least 3 characters long",
 			}},
 		{name: "Long Body", urlPath: wantUrl, wantCode: http.StatusUnprocessableEntity,
 			envelopeName: "error",
@@ -195,6 +237,7 @@ func TestCreateBlogHandler(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodPost, tt.urlPath, strings.NewReader(string(reqBodyJSON)))
+			r = app.contextSetUser(r, mock.User)
 
 			app.createBlogHandler(w, r)
 
@@ -215,13 +258,13 @@ func TestShowBlogHandler(t *testing.T) {
 		{
 			name:    "Valid ID",
 			urlPath: "/v1/blogs/",
-			param:   "11", wantCode: http.StatusOK,
+			param:   "1", wantCode: http.StatusOK,
 			wantBody: wantBodySuccess,
 		},
 		{
 			name:     "Valid String ID",
-			urlPath:  "/v1/blogs/\"11\"",
-			param:    "11",
+			urlPath:  "/v1/blogs/\"1\"",
+			param:    "1",
 			wantCode: http.StatusOK,
 			wantBody: wantBodySuccess,
 		},
@@ -234,15 +277,15 @@ func TestShowBlogHandler(t *testing.T) {
 		},
 		{
 			name:     "Non-existent ID",
-			urlPath:  "/v1/blogs/12",
-			param:    "12",
+			urlPath:  "/v1/blogs/2",
+			param:    "2",
 			wantCode: http.StatusNotFound,
 			wantBody: []byte("{\n\t\"error\": \"the requested resource could not be found\"\n}\n"),
 		},
 		{
 			name:     "Non-existent String ID",
-			urlPath:  "/v1/blogs/\"12\"",
-			param:    "12",
+			urlPath:  "/v1/blogs/\"2\"",
+			param:    "2",
 			wantCode: http.StatusNotFound,
 			wantBody: []byte("{\n\t\"error\": \"the requested resource could not be found\"\n}\n"),
 		},
@@ -277,6 +320,74 @@ func TestShowBlogHandler(t *testing.T) {
 	}
 }
 
+func TestShowBlogBySlugHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name         string
+		slug         string
+		wantCode     int
+		wantLocation string
+	}{
+		{name: "Current Slug", slug: mock.Blog.Slug, wantCode: http.StatusOK},
+		{name: "Old Slug", slug: mock.OldSlug, wantCode: http.StatusMovedPermanently,
+			wantLocation: "/v1/blogs/by-slug/" + mock.Blog.Slug},
+		{name: "Unknown Slug", slug: "rest-in-go", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs/by-slug/"+tt.slug, nil, httprouter.Params{
+				{Key: "slug", Value: tt.slug},
+			})
+
+			app.showBlogBySlugHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location -> want: %q; got: %q", tt.wantLocation, got)
+			}
+		})
+	}
+}
+
+func TestListBlogHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+	}{
+		{name: "Must Success", query: "", wantCode: http.StatusOK},
+		{name: "Search", query: "?q=grpc&lang=english", wantCode: http.StatusOK},
+		{name: "Search By Rank", query: "?q=grpc&sort=-rank", wantCode: http.StatusOK},
+		{name: "Rank Without Search", query: "?sort=-rank", wantCode: http.StatusUnprocessableEntity},
+		{name: "Unknown Language", query: "?q=grpc&lang=klingon", wantCode: http.StatusUnprocessableEntity},
+		{name: "First Cursor Page", query: "?cursor=&count=true", wantCode: http.StatusOK},
+		{name: "Invalid Cursor", query: "?cursor=abc.def", wantCode: http.StatusUnprocessableEntity},
+		{name: "Invalid Count", query: "?cursor=&count=maybe", wantCode: http.StatusUnprocessableEntity},
+		{name: "Rank With Cursor", query: "?q=grpc&cursor=&sort=-rank", wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs"+tt.query, nil, nil)
+
+			app.listBlogHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+		})
+	}
+}
+
 func TestDeleteBlogHandler(t *testing.T) {
 	app := NewTestApplication(mock.NewModel())
 
@@ -289,13 +400,13 @@ func TestDeleteBlogHandler(t *testing.T) {
 		{
 			name:    "Valid ID",
 			urlPath: "/v1/blogs/",
-			param:   "11", wantCode: http.StatusOK,
+			param:   "1", wantCode: http.StatusOK,
 			wantBody: wantBodySuccess,
 		},
 		{
 			name:     "Valid String ID",
-			urlPath:  "/v1/blogs/\"11\"",
-			param:    "11",
+			urlPath:  "/v1/blogs/\"1\"",
+			param:    "1",
 			wantCode: http.StatusOK,
 			wantBody: wantBodySuccess,
 		},
@@ -308,15 +419,15 @@ func TestDeleteBlogHandler(t *testing.T) {
 		},
 		{
 			name:     "Non-existent ID",
-			urlPath:  "/v1/blogs/12",
-			param:    "12",
+			urlPath:  "/v1/blogs/2",
+			param:    "2",
 			wantCode: http.StatusNotFound,
 			wantBody: []byte("{\n\t\"error\": \"the requested resource could not be found\"\n}\n"),
 		},
 		{
 			name:     "Non-existent String ID",
-			urlPath:  "/v1/blogs/\"12\"",
-			param:    "12",
+			urlPath:  "/v1/blogs/\"2\"",
+			param:    "2",
 			wantCode: http.StatusNotFound,
 			wantBody: []byte("{\n\t\"error\": \"the requested resource could not be found\"\n}\n"),
 		},
@@ -339,6 +450,9 @@ func TestDeleteBlogHandler(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
+			// Every case needs the blog, so none may see another's deletion.
+			app := NewTestApplication(mock.NewModel())
+
 			w := httptest.NewRecorder()
 			r := NewRequestWithContext(http.MethodDelete, tt.urlPath, nil, httprouter.Params{
 				{"id", tt.param},
@@ -351,20 +465,45 @@ func TestDeleteBlogHandler(t *testing.T) {
 	}
 }
 
+func TestDeleteBlogHandlerNotAuthor(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	test := TestCases{
+		name:     "Not Author",
+		urlPath:  "/v1/blogs/1",
+		param:    "1",
+		wantCode: http.StatusForbidden,
+		wantBody: []byte("{\n\t\"error\": \"your user account doesn't have the necessary permissions to access this resource\"\n}\n"),
+	}
+
+	t.Run(test.name, func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := NewRequestWithContext(http.MethodDelete, test.urlPath, nil, httprouter.Params{
+			{Key: "id", Value: test.param},
+		})
+		r = app.contextSetUser(r, &data.User{ID: 8, Name: "Stranger", Activated: true})
+
+		app.deleteBlogHandler(w, r)
+
+		Check(t, w, test)
+	})
+}
+
 func TestUpdateBlogHandler(t *testing.T) {
 	app := NewTestApplication(mock.NewModel())
 
-	wantBlog := mock.Blog
+	wantBlog := *mock.Blog
 	wantBlog.Body = "I will learn."
 	wantBlog.Title = "gRPC in Golang!"
+	wantBlog.Slug = "grpc-in-golang"
 	wantBlog.Category = []string{"Golang", "Network", "Framework"}
 	wantBlog.Version = wantBlog.Version + 1
 
 	tests := []TestCases{
 		{
 			name:     "Must Success",
-			urlPath:  "/v1/blogs/11",
-			param:    "11",
+			urlPath:  "/v1/blogs/1",
+			param:    "1",
 			wantCode: http.StatusOK,
 			reqBody: testBlog{
 				Title:    "gRPC in Golang!",
@@ -389,8 +528,8 @@ func TestUpdateBlogHandler(t *testing.T) {
 		},
 		{
 			name:     "Non-existent ID",
-			urlPath:  "/v1/blogs/12",
-			param:    "12",
+			urlPath:  "/v1/blogs/2",
+			param:    "2",
 			wantCode: http.StatusNotFound,
 			reqBody: testBlog{
 				Title:    "gRPC in Golang!",
@@ -402,8 +541,8 @@ func TestUpdateBlogHandler(t *testing.T) {
 		},
 		{
 			name:     "Non-existent String ID",
-			urlPath:  "/v1/blogs/\"12\"",
-			param:    "12",
+			urlPath:  "/v1/blogs/\"2\"",
+			param:    "2",
 			wantCode: http.StatusNotFound,
 			reqBody: testBlog{
 				Title:    "gRPC in Golang!",
@@ -465,4 +604,265 @@ func TestUpdateBlogHandler(t *testing.T) {
 	}
 }
 
-// TODO: Write test for listBlogHandler
+func TestUpdateBlogHandlerIfMatch(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name     string
+		ifMatch  func() string
+		wantCode int
+	}{
+		{name: "No Header", ifMatch: func() string { return "" }, wantCode: http.StatusOK},
+		{name: "Wildcard", ifMatch: func() string { return "*" }, wantCode: http.StatusOK},
+		{name: "Current Version", ifMatch: func() string {
+			return `"1", ` + app.versionETag(mock.Blog.Version)
+		}, wantCode: http.StatusOK},
+		{name: "Outdated Version", ifMatch: func() string {
+			return app.versionETag(mock.Blog.Version - 1)
+		}, wantCode: http.StatusPreconditionFailed},
+		{name: "Weak Tag", ifMatch: func() string {
+			return "W/" + app.versionETag(mock.Blog.Version)
+		}, wantCode: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(mock.NewModel())
+
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPut, "/v1/blogs/1", []byte(`{"title": "gRPC in Go!"}`),
+				httprouter.Params{{Key: "id", Value: "1"}})
+
+			if tag := tt.ifMatch(); tag != "" {
+				r.Header.Set("If-Match", tag)
+			}
+
+			app.updateBlogHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if w.Code == http.StatusOK && w.Header().Get("ETag") != app.versionETag(mock.Blog.Version+1) {
+				t.Errorf("ETag -> want: %s; got: %s", app.versionETag(mock.Blog.Version+1), w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestPatchBlogHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		reqBody      string
+		wantCode     int
+		wantCategory []string
+	}{
+		{
+			name:         "Merge Patch",
+			contentType:  "application/merge-patch+json",
+			reqBody:      `{"category": ["Golang", "Network"]}`,
+			wantCode:     http.StatusOK,
+			wantCategory: []string{"Golang", "Network"},
+		},
+		{
+			name:        "JSON Patch",
+			contentType: "application/json-patch+json",
+			reqBody: `[{"op": "replace", "path": "/category", "value": ["Golang", "Network"]},
+				{"op": "test", "path": "/category/1", "value": "Network"},
+				{"op": "add", "path": "/category/-", "value": "RPC"},
+				{"op": "remove", "path": "/category/0"}]`,
+			wantCode:     http.StatusOK,
+			wantCategory: []string{"Network", "RPC"},
+		},
+		{
+			name:        "Failed Test",
+			contentType: "application/json-patch+json",
+			reqBody:     `[{"op": "test", "path": "/category/0", "value": "Rust"}]`,
+			wantCode:    http.StatusConflict,
+		},
+		{
+			name:        "Unknown Member",
+			contentType: "application/merge-patch+json",
+			reqBody:     `{"version": 1}`,
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Invalid Blog",
+			contentType: "application/json-patch+json",
+			reqBody:     `[{"op": "remove", "path": "/title"}]`,
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Unsupported Media Type",
+			contentType: "application/json",
+			reqBody:     `{"title": "gRPC in Go!"}`,
+			wantCode:    http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(mock.NewModel())
+
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPatch, "/v1/blogs/1", []byte(tt.reqBody),
+				httprouter.Params{{Key: "id", Value: "1"}})
+			r.Header.Set("Content-Type", tt.contentType)
+
+			app.patchBlogHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status Code -> want: %d; got: %d (%s)", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantCategory == nil {
+				return
+			}
+
+			var got struct {
+				Blog data.Blog `json:"blog"`
+			}
+
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got.Blog.Category, tt.wantCategory) {
+				t.Errorf("Category -> want: %v; got: %v", tt.wantCategory, got.Blog.Category)
+			}
+		})
+	}
+}
+
+func TestCanViewBlog(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	stranger := insertUser(t, model, "ferris@example.com", true)
+	admin := insertUser(t, model, "admin@example.com", true)
+
+	err := model.Permission.AddForUser(context.Background(), admin.ID, data.PermissionAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := map[string]*data.User{"Anonymous": data.AnonymousUser, "Author": mock.User,
+		"Stranger": stranger, "Admin": admin}
+
+	tests := []struct {
+		status   string
+		wantView map[string]bool
+	}{
+		{status: data.StatusPublished,
+			wantView: map[string]bool{"Anonymous": true, "Author": true, "Stranger": true, "Admin": true}},
+		{status: data.StatusDraft, wantView: map[string]bool{"Author": true, "Admin": true}},
+		{status: data.StatusScheduled, wantView: map[string]bool{"Author": true, "Admin": true}},
+		{status: data.StatusArchived, wantView: map[string]bool{"Author": true, "Admin": true}},
+	}
+
+	for _, tt := range tests {
+		for name, user := range users {
+			t.Run(tt.status+" "+name, func(t *testing.T) {
+				blog := *mock.Blog
+				blog.Status = tt.status
+
+				ok, err := app.canViewBlog(context.Background(), user, &blog)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if ok != tt.wantView[name] {
+					t.Errorf("View -> want: %t; got: %t", tt.wantView[name], ok)
+				}
+			})
+		}
+	}
+}
+
+func TestListBlogHandlerStatus(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	stranger := insertUser(t, model, "ferris@example.com", true)
+	admin := insertUser(t, model, "admin@example.com", true)
+
+	err := model.Permission.AddForUser(context.Background(), admin.ID, data.PermissionAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insertBlog := func(title string, author *data.User, status string) int64 {
+		blog := &data.Blog{Title: title, Body: "I do not know yet", Category: []string{"Golang"},
+			Author: &data.Author{ID: author.ID}, Status: status}
+
+		err := model.Blog.Insert(context.Background(), blog)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return blog.ID
+	}
+
+	draft := insertBlog("gRPC streaming", mock.User, data.StatusDraft)
+	strangerDraft := insertBlog("Rust in Go", stranger, data.StatusDraft)
+	archived := insertBlog("gRPC gateway", mock.User, data.StatusArchived)
+
+	tests := []struct {
+		name     string
+		query    string
+		user     *data.User
+		wantCode int
+		wantIDs  []int64
+	}{
+		{name: "Anonymous Published", query: "", user: data.AnonymousUser, wantCode: http.StatusOK,
+			wantIDs: []int64{mock.Blog.ID}},
+		{name: "Anonymous Draft", query: "?status=draft", user: data.AnonymousUser,
+			wantCode: http.StatusUnauthorized},
+		{name: "Own Drafts", query: "?status=draft", user: mock.User, wantCode: http.StatusOK,
+			wantIDs: []int64{draft}},
+		{name: "Own Archived", query: "?status=archived", user: mock.User, wantCode: http.StatusOK,
+			wantIDs: []int64{archived}},
+		{name: "Other Author's Drafts", query: "?status=draft&author=" + strconv.FormatInt(stranger.ID, 10),
+			user: mock.User, wantCode: http.StatusForbidden},
+		{name: "Admin", query: "?status=draft&author=" + strconv.FormatInt(stranger.ID, 10),
+			user: admin, wantCode: http.StatusOK, wantIDs: []int64{strangerDraft}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs"+tt.query, nil, nil)
+			r = app.contextSetUser(r, tt.user)
+
+			app.listBlogHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantIDs == nil {
+				return
+			}
+
+			var got struct {
+				Blogs []data.Blog `json:"blogs"`
+			}
+
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int64
+			for _, blog := range got.Blogs {
+				ids = append(ids, blog.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("IDs -> want: %v; got: %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
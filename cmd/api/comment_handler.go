@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"github.com/tomasen/realip"
+	"net/http"
+	"time"
+)
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		ParentID *int64 `json:"parent_id"`
+		Body     string `json:"body"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, ok := app.readVisibleBlog(w, r, id); !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	comment := &data.Comment{
+		BlogID:   id,
+		ParentID: input.ParentID,
+		Author:   &data.Author{ID: user.ID, Name: user.Name},
+		Body:     input.Body,
+	}
+
+	v := validator.New()
+
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Decide the status of the comment from the rules, using the same client
+	// address the rate limiter keys on.
+	rules := app.config.comments.moderation
+	comment.IP = realip.FromRequest(r)
+
+	history, err := app.model.Comment.CommenterHistory(r.Context(), user.ID, comment.IP, time.Now().Add(-rules.IPWindow))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rules.Moderate(comment, history)
+
+	err = app.model.Comment.Insert(r.Context(), comment)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrInvalidParent):
+			v.AddError("parent_id", "must be an approved comment on the same blog")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &constraintErr):
+			app.failedValidationResponse(w, r, constraintErr.Errors())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/blogs/%d/comments", id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"comment": comment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommentsHandler returns a page of a blog's top-level comments with
+// their replies nested to the requested depth, which can't exceed the
+// configured maximum.
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Depth int
+		data.Filter
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+
+	maxDepth := app.config.comments.maxDepth
+
+	input.Depth = app.readInt(query, "depth", maxDepth, v)
+	v.Check(input.Depth > 0, "depth", "must be greater than zero")
+	v.Check(input.Depth <= maxDepth, "depth", fmt.Sprintf("must be a maximum of %d", maxDepth))
+
+	input.Filter.Page = app.readInt(query, "page", 1, v)
+	input.Filter.PageSize = app.readInt(query, "page_size", 20, v)
+	input.Filter.Sort = app.readString(query, "sort", "created_at")
+
+	input.Filter.SortSafeList = []string{"created_at", "-created_at"}
+
+	if data.ValidateFilter(v, input.Filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, ok := app.readVisibleBlog(w, r, id); !ok {
+		return
+	}
+
+	comments, metadata, err := app.model.Comment.GetAll(r.Context(), id, input.Depth, input.Filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := app.paginationLinks(r, &metadata)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCommentHandler removes a comment and its replies. Comments can be
+// deleted by their author, by the author of the blog and by admins.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment, err := app.model.Comment.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ok, err := app.canDeleteComment(r.Context(), app.contextGetUser(r), comment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.model.Comment.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "comment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) canDeleteComment(ctx context.Context, user *data.User, comment *data.Comment) (bool, error) {
+	if comment.IsAuthor(user.ID) {
+		return true, nil
+	}
+
+	blog, err := app.model.Blog.Get(ctx, comment.BlogID)
+	if err != nil {
+		return false, err
+	}
+
+	return app.canModifyBlog(ctx, user, blog)
+}
+
+// moderatedComment is the view of a comment in the moderation queue, the
+// only place its moderation state and flags are shown.
+type moderatedComment struct {
+	*data.Comment
+	Status string   `json:"status"`
+	Flags  []string `json:"flags"`
+}
+
+// listModerationQueueHandler lists the comments in a moderation state across
+// all blogs, pending ones by default, oldest first.
+func (app *application) listModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filter
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+
+	input.Status = app.readString(query, "status", data.CommentPending)
+	v.Check(validator.In(input.Status, data.CommentStatuses...), "status", "invalid status value")
+
+	input.Filter.Page = app.readInt(query, "page", 1, v)
+	input.Filter.PageSize = app.readInt(query, "page_size", 20, v)
+	input.Filter.Sort = app.readString(query, "sort", "created_at")
+
+	input.Filter.SortSafeList = []string{"created_at", "-created_at"}
+
+	if data.ValidateFilter(v, input.Filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := app.model.Comment.GetAllByStatus(r.Context(), input.Status, input.Filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	moderated := make([]moderatedComment, len(comments))
+	for i, comment := range comments {
+		moderated[i] = moderatedComment{Comment: comment, Status: comment.Status, Flags: comment.Flags}
+	}
+
+	headers := app.paginationLinks(r, &metadata)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comments": moderated, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) approveCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	app.setCommentsStatus(w, r, data.CommentApproved)
+}
+
+func (app *application) rejectCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	app.setCommentsStatus(w, r, data.CommentSpam)
+}
+
+// setCommentsStatus moves the comments listed in the request body to the
+// given moderation state.
+func (app *application) setCommentsStatus(w http.ResponseWriter, r *http.Request, status string) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.IDs) >= 1, "ids", "must contain at least 1 id")
+	v.Check(len(input.IDs) <= 100, "ids", "must not contain more than 100 ids")
+	for _, id := range input.IDs {
+		v.Check(id > 0, "ids", "must only contain ids greater than zero")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	updated, err := app.model.Comment.SetStatus(r.Context(), status, input.IDs...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"status": status, "updated": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
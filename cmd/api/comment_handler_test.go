@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCreateCommentHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name     string
+		param    string
+		reqBody  string
+		wantCode int
+	}{
+		{name: "Must Success", param: "1", reqBody: `{"body": "Great post!"}`,
+			wantCode: http.StatusCreated},
+		{name: "Reply", param: "1", reqBody: `{"parent_id": 1, "body": "Agreed."}`,
+			wantCode: http.StatusCreated},
+		{name: "Empty Body", param: "1", reqBody: `{"body": ""}`,
+			wantCode: http.StatusUnprocessableEntity},
+		{name: "Unknown Parent", param: "1", reqBody: `{"parent_id": 99, "body": "Agreed."}`,
+			wantCode: http.StatusUnprocessableEntity},
+		{name: "Unknown Blog", param: "2", reqBody: `{"body": "Great post!"}`,
+			wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/blogs/"+tt.param+"/comments", []byte(tt.reqBody),
+				httprouter.Params{{Key: "id", Value: tt.param}})
+
+			app.createCommentHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestListCommentsHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+	app.config.comments.maxDepth = 3
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+	}{
+		{name: "Default Depth", query: "", wantCode: http.StatusOK},
+		{name: "Top Level Only", query: "?depth=1", wantCode: http.StatusOK},
+		{name: "Too Deep", query: "?depth=4", wantCode: http.StatusUnprocessableEntity},
+		{name: "Zero Depth", query: "?depth=0", wantCode: http.StatusUnprocessableEntity},
+		{name: "Invalid Sort", query: "?sort=body", wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs/1/comments"+tt.query, nil,
+				httprouter.Params{{Key: "id", Value: "1"}})
+
+			app.listCommentsHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteCommentHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		param    string
+		user     *data.User
+		wantCode int
+	}{
+		{name: "Author", param: "1", user: mock.User, wantCode: http.StatusOK},
+		{name: "Not Author", param: "1", user: &data.User{ID: 8, Name: "Stranger", Activated: true},
+			wantCode: http.StatusForbidden},
+		{name: "Not Found", param: "2", user: mock.User, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(mock.NewModel())
+
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodDelete, "/v1/comments/"+tt.param, nil,
+				httprouter.Params{{Key: "id", Value: tt.param}})
+			r = app.contextSetUser(r, tt.user)
+
+			app.deleteCommentHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestApproveCommentsHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name     string
+		reqBody  string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Must Success", reqBody: `{"ids": [1, 2]}`, wantCode: http.StatusOK,
+			wantBody: "{\n\t\"status\": \"approved\",\n\t\"updated\": 1\n}\n"},
+		{name: "No IDs", reqBody: `{"ids": []}`, wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"ids\": \"must contain at least 1 id\"\n\t}\n}\n"},
+		{name: "Invalid ID", reqBody: `{"ids": [1, 0]}`, wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"ids\": \"must only contain ids greater than zero\"\n\t}\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/comments/moderation/approve", []byte(tt.reqBody), nil)
+
+			app.approveCommentsHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestListModerationQueueHandler(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	held := &data.Comment{BlogID: mock.Blog.ID, Author: &data.Author{ID: mock.User.ID}, Body: "Buy now!",
+		Status: data.CommentPending, Flags: []string{data.FlagFirstComment}}
+
+	err := model.Comment.Insert(context.Background(), held)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := NewRequestWithContext(http.MethodGet, "/v1/comments/moderation", nil, nil)
+
+	app.listModerationQueueHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status Code -> want: %d; got: %d; body: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var got struct {
+		Comments []struct {
+			ID     int64    `json:"id"`
+			Body   string   `json:"body"`
+			Status string   `json:"status"`
+			Flags  []string `json:"flags"`
+		} `json:"comments"`
+	}
+
+	err = json.NewDecoder(w.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Comments) != 1 || got.Comments[0].ID != held.ID || got.Comments[0].Body != held.Body ||
+		got.Comments[0].Status != data.CommentPending ||
+		!reflect.DeepEqual(got.Comments[0].Flags, []string{data.FlagFirstComment}) {
+		t.Errorf("Comments -> want comment %d with its status and flags; got: %+v", held.ID, got.Comments)
+	}
+}
+
+func TestListCommentsHandlerHidesModeration(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+	app.config.comments.maxDepth = 3
+
+	w := httptest.NewRecorder()
+	r := NewRequestWithContext(http.MethodGet, "/v1/blogs/1/comments", nil,
+		httprouter.Params{{Key: "id", Value: "1"}})
+
+	app.listCommentsHandler(w, r)
+
+	var got struct {
+		Comments []map[string]interface{} `json:"comments"`
+	}
+
+	err := json.NewDecoder(w.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Comments) != 1 {
+		t.Fatalf("Comments -> want: 1; got: %d", len(got.Comments))
+	}
+
+	for _, key := range []string{"status", "flags"} {
+		if _, ok := got.Comments[0][key]; ok {
+			t.Errorf("Comment -> want no %q member; got: %v", key, got.Comments[0])
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"net/http"
+)
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// contextSetUser returns a copy of the request with the given user stored in its context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser retrieves the user stored by the authenticate middleware.
+// It is only called when we logically expect a user value to be present,
+// so a missing value is an unexpected error and we panic.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
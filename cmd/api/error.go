@@ -22,8 +22,27 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+// logCancelled logs a request abandoned by its client while it was being
+// processed.
+func (app *application) logCancelled(r *http.Request, err error) {
+	app.logger.PrintInfo("request cancelled", map[string]string{
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
+		"error":          err.Error(),
+	})
+}
+
+// serverErrorResponse logs the error and sends a 500 response. When the
+// request itself was cancelled, it is only logged as a cancellation, as
+// nobody is waiting for the response. A cancelled query of a live request
+// is still a server error.
 func (app *application) serverErrorResponse(w http.ResponseWriter,
 	r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		app.logCancelled(r, err)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
@@ -63,6 +82,30 @@ func (app *application) editConflictResponse(w http.ResponseWriter,
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter,
+	r *http.Request) {
+	message := "unable to update the record because it has changed since you fetched it, please fetch it again"
+
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) unsupportedPatchMediaTypeResponse(w http.ResponseWriter,
+	r *http.Request) {
+	w.Header().Set("Accept-Patch", "application/merge-patch+json, application/json-patch+json")
+	message := "the Content-Type must be application/merge-patch+json or application/json-patch+json"
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) unprocessablePatchResponse(w http.ResponseWriter,
+	r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "unable to apply the patch: "+err.Error())
+}
+
+func (app *application) patchTestFailedResponse(w http.ResponseWriter,
+	r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, "unable to apply the patch: "+err.Error())
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter,
 	r *http.Request) {
 	message := "rate limit exceeded"
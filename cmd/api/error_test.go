@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerErrorResponse(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		wantCode int
+		wantLog  string
+	}{
+		{name: "Server Error", ctx: context.Background(), err: errors.New("pq: connection refused"),
+			wantCode: http.StatusInternalServerError, wantLog: `"level":"ERROR"`},
+		{name: "Cancelled Query", ctx: context.Background(), err: context.Canceled,
+			wantCode: http.StatusInternalServerError, wantLog: `"level":"ERROR"`},
+		{name: "Cancelled Request", ctx: cancelled, err: errors.New("pq: canceling statement due to user request"),
+			wantCode: http.StatusOK, wantLog: `"message":"request cancelled"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			app := &application{logger: jsonlog.New(&out, jsonlog.LevelInfo)}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/blogs", nil).WithContext(tt.ctx)
+
+			app.serverErrorResponse(w, r, tt.err)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if !strings.Contains(out.String(), tt.wantLog) {
+				t.Errorf("Log -> want: %s; got: %s", tt.wantLog, out.String())
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/3n0ugh/BasedWeb/internal/data"
 	"github.com/3n0ugh/BasedWeb/internal/validator"
 	"github.com/julienschmidt/httprouter"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]interface{}
@@ -106,6 +108,52 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+// build a strong entity tag from a record version
+func (app *application) versionETag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// report whether the If-Match header allows modifying the resource with the
+// given entity tag. A missing header matches anything. If-Match uses strong
+// comparison, so weak tags never match.
+func (app *application) ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// read the raw request body, with the same size limit as readJSON
+func (app *application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := 1_048_576
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+
+	return body, nil
+}
+
 // read id from request
 func (app *application) readParamID(r *http.Request) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
@@ -117,6 +165,17 @@ func (app *application) readParamID(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// read version from request
+func (app *application) readParamVersion(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return -1, errors.New("invalid version parameter")
+	}
+	return int32(version), nil
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 
 	s := qs.Get(key)
@@ -156,3 +215,119 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int,
 
 	return i
 }
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool,
+	v *validator.Validator) bool {
+
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// paginationLinks adds the URLs of the first, previous, next and last pages
+// of a listing to its metadata, and returns them as an RFC 8288 Link header.
+// The URLs keep the query parameters of the request apart from the page or
+// the cursor. Keyset listings have no last page link.
+func (app *application) paginationLinks(r *http.Request, metadata *data.Metadata) http.Header {
+	query := r.URL.Query()
+	keyset := query.Has("cursor")
+
+	link := func(key, value string) string {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Del("page")
+		q.Del("cursor")
+		q.Set(key, value)
+
+		return r.URL.Path + "?" + q.Encode()
+	}
+
+	links := make(map[string]string)
+
+	switch {
+	case keyset:
+		links["first"] = link("cursor", "")
+		if metadata.PrevCursor != "" {
+			links["prev"] = link("cursor", metadata.PrevCursor)
+		}
+		if metadata.NextCursor != "" {
+			links["next"] = link("cursor", metadata.NextCursor)
+		}
+	case metadata.TotalRecords > 0:
+		links["first"] = link("page", strconv.Itoa(metadata.FirstPage))
+		if metadata.CurrentPage > metadata.FirstPage {
+			links["prev"] = link("page", strconv.Itoa(metadata.CurrentPage-1))
+		}
+		if metadata.CurrentPage < metadata.LastPage {
+			links["next"] = link("page", strconv.Itoa(metadata.CurrentPage+1))
+		}
+		links["last"] = link("page", strconv.Itoa(metadata.LastPage))
+	}
+
+	headers := make(http.Header)
+
+	if len(links) == 0 {
+		return headers
+	}
+
+	metadata.Links = links
+
+	var values []string
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if href, ok := links[rel]; ok {
+			values = append(values, fmt.Sprintf(`<%s>; rel="%s"`, href, rel))
+		}
+	}
+
+	headers.Set("Link", strings.Join(values, ", "))
+
+	return headers
+}
+
+// background runs fn in a goroutine tracked by the application's WaitGroup.
+// A panic in fn is recovered and logged instead of crashing the server.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// waitBackground blocks until every background task has finished or the
+// timeout elapses, in which case it returns an error.
+func (app *application) waitBackground(timeout time.Duration) error {
+	done := make(chan struct{})
+
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("background tasks still running after %s", timeout)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackground(t *testing.T) {
+	var out bytes.Buffer
+
+	app := &application{
+		logger: jsonlog.New(&out, jsonlog.LevelInfo),
+	}
+
+	ran := make(chan struct{})
+
+	app.background(func() {
+		close(ran)
+	})
+
+	app.background(func() {
+		panic("boom")
+	})
+
+	if err := app.waitBackground(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ran:
+	default:
+		t.Error("Task -> want: ran; got: not ran")
+	}
+
+	if !strings.Contains(out.String(), `"message":"boom"`) {
+		t.Errorf("Log -> want the recovered panic; got: %q", out.String())
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+
+	app.background(func() {
+		<-block
+	})
+
+	if err := app.waitBackground(10 * time.Millisecond); err == nil {
+		t.Error("Wait -> want: timeout error; got: nil")
+	}
+}
+
+func TestPaginationLinks(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name      string
+		url       string
+		metadata  data.Metadata
+		wantLinks map[string]string
+		wantLink  string
+	}{
+		{name: "Middle Page",
+			url:      "/v1/blogs?title=go&category=Golang,Network&sort=-id&page=2&page_size=5",
+			metadata: data.Metadata{CurrentPage: 2, PageSize: 5, FirstPage: 1, LastPage: 3, TotalRecords: 12},
+			wantLinks: map[string]string{
+				"first": "/v1/blogs?category=Golang%2CNetwork&page=1&page_size=5&sort=-id&title=go",
+				"prev":  "/v1/blogs?category=Golang%2CNetwork&page=1&page_size=5&sort=-id&title=go",
+				"next":  "/v1/blogs?category=Golang%2CNetwork&page=3&page_size=5&sort=-id&title=go",
+				"last":  "/v1/blogs?category=Golang%2CNetwork&page=3&page_size=5&sort=-id&title=go",
+			},
+			wantLink: `</v1/blogs?category=Golang%2CNetwork&page=1&page_size=5&sort=-id&title=go>; rel="first", ` +
+				`</v1/blogs?category=Golang%2CNetwork&page=1&page_size=5&sort=-id&title=go>; rel="prev", ` +
+				`</v1/blogs?category=Golang%2CNetwork&page=3&page_size=5&sort=-id&title=go>; rel="next", ` +
+				`</v1/blogs?category=Golang%2CNetwork&page=3&page_size=5&sort=-id&title=go>; rel="last"`},
+		{name: "Only Page",
+			url:      "/v1/blogs",
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 3},
+			wantLinks: map[string]string{
+				"first": "/v1/blogs?page=1",
+				"last":  "/v1/blogs?page=1",
+			},
+			wantLink: `</v1/blogs?page=1>; rel="first", </v1/blogs?page=1>; rel="last"`},
+		{name: "No Records",
+			url:      "/v1/blogs?title=rust",
+			metadata: data.Metadata{}},
+		{name: "Cursor",
+			url:      "/v1/blogs?sort=title&cursor=abc",
+			metadata: data.Metadata{PageSize: 20, NextCursor: "def", PrevCursor: "ghi"},
+			wantLinks: map[string]string{
+				"first": "/v1/blogs?cursor=&sort=title",
+				"prev":  "/v1/blogs?cursor=ghi&sort=title",
+				"next":  "/v1/blogs?cursor=def&sort=title",
+			},
+			wantLink: `</v1/blogs?cursor=&sort=title>; rel="first", ` +
+				`</v1/blogs?cursor=ghi&sort=title>; rel="prev", ` +
+				`</v1/blogs?cursor=def&sort=title>; rel="next"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			metadata := tt.metadata
+
+			headers := app.paginationLinks(r, &metadata)
+
+			if !reflect.DeepEqual(metadata.Links, tt.wantLinks) {
+				t.Errorf("Links -> want: %v; got: %v", tt.wantLinks, metadata.Links)
+			}
+
+			if got := headers.Get("Link"); got != tt.wantLink {
+				t.Errorf("Link -> want: %q; got: %q", tt.wantLink, got)
+			}
+		})
+	}
+}
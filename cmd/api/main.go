@@ -2,43 +2,97 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/3n0ugh/BasedWeb/internal/data"
 	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
-	"net/http"
+	"github.com/3n0ugh/BasedWeb/internal/mailer"
+	"github.com/3n0ugh/BasedWeb/internal/migrate"
+	"github.com/3n0ugh/BasedWeb/internal/validator"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
 type config struct {
-	port int
-	db   struct {
+	port            int
+	shutdownTimeout time.Duration
+	// storage is "postgres", or "memory" to keep the records in memory.
+	storage string
+	// memory holds the activated admin created when storing in memory, as
+	// nobody could grant the permissions to write blogs otherwise.
+	memory struct {
+		adminEmail    string
+		adminPassword string
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		queryTimeout time.Duration
+		// allowOutdatedSchema lets the server start with pending migrations.
+		allowOutdatedSchema bool
 	}
 	limiter struct {
 		rps     float64
 		burst   int
 		enabled bool
 	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	mailDir    string
+	background struct {
+		drainTimeout time.Duration
+	}
+	scheduler struct {
+		interval time.Duration
+	}
+	cursor struct {
+		secret string
+	}
+	comments struct {
+		maxDepth   int
+		moderation data.ModerationRules
+	}
 }
 
 type application struct {
 	config config
 	logger *jsonlog.Logger
 	model  data.Model
+	mailer mailer.Mailer
+	wg     sync.WaitGroup
+	// done is closed when the server starts shutting down, to stop the
+	// long-running maintenance goroutines.
+	done chan struct{}
 }
 
 func main() {
 	var cfg config
 
 	flag.IntVar(&cfg.port, "port", 8080, "API server port")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"Maximum time to wait for in-flight requests on shutdown")
+
+	flag.StringVar(&cfg.storage, "storage", "postgres",
+		"Where records are stored (postgres|memory); memory loses them on exit")
+
+	flag.StringVar(&cfg.memory.adminEmail, "memory-admin-email", "",
+		"Email of an activated admin created on start with -storage=memory")
+	flag.StringVar(&cfg.memory.adminPassword, "memory-admin-password", "",
+		"Password of the admin created with -memory-admin-email")
 
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25,
@@ -47,38 +101,212 @@ func main() {
 		"PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m",
 		"PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second,
+		"PostgreSQL maximum duration of a query")
+	flag.BoolVar(&cfg.db.allowOutdatedSchema, "db-allow-outdated-schema", false,
+		"Start the server even when database migrations are pending")
 
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "BasedWeb <no-reply@basedweb.local>", "SMTP sender")
+	flag.StringVar(&cfg.mailDir, "mail-dir", "",
+		"Write emails as .eml files into this directory instead of sending them over SMTP")
+
+	flag.DurationVar(&cfg.background.drainTimeout, "background-drain-timeout", 20*time.Second,
+		"Maximum time to wait for background tasks on shutdown")
+
+	flag.DurationVar(&cfg.scheduler.interval, "scheduler-interval", time.Minute,
+		"How often scheduled blogs are checked for publishing")
+
+	flag.StringVar(&cfg.cursor.secret, "cursor-secret", "",
+		"Key signing the pagination cursors (random on every start if empty)")
+
+	flag.IntVar(&cfg.comments.maxDepth, "comments-max-depth", 5,
+		"Maximum depth of the comment threads returned by the listing")
+
+	flag.Func("moderation-banned-words", "Comma separated words marking a comment as spam",
+		func(val string) error {
+			for _, word := range strings.Split(val, ",") {
+				if word = strings.TrimSpace(word); word != "" {
+					cfg.comments.moderation.BannedWords = append(cfg.comments.moderation.BannedWords, word)
+				}
+			}
+			return nil
+		})
+	flag.IntVar(&cfg.comments.moderation.MaxLinks, "moderation-max-links", 2,
+		"Maximum links in a comment before it is held for moderation")
+	flag.BoolVar(&cfg.comments.moderation.HoldFirstComment, "moderation-hold-first-comment", true,
+		"Hold comments of users without an approved comment for moderation")
+	flag.IntVar(&cfg.comments.moderation.MaxPerIP, "moderation-ip-max", 5,
+		"Maximum comments from an IP address within the window before they are spam (0 disables)")
+	flag.DurationVar(&cfg.comments.moderation.IPWindow, "moderation-ip-window", 10*time.Minute,
+		"Window the per IP address comment limit is counted in")
+
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	db, err := openDB(cfg)
-	if err != nil {
-		logger.PrintFatal(err, nil)
+	if cfg.cursor.secret == "" {
+		secret := make([]byte, 32)
+
+		_, err := rand.Read(secret)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		cfg.cursor.secret = string(secret)
+
+		logger.PrintInfo("no cursor secret set, using a random one", map[string]string{
+			"warning": "cursors break on restart and across instances; set -cursor-secret in production",
+		})
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			panic(err)
+
+	var model data.Model
+	var db *sql.DB
+
+	switch cfg.storage {
+	case "postgres":
+		db = openPostgres(cfg, logger)
+		model = data.NewModel(db, cfg.db.queryTimeout)
+	case "memory":
+		if flag.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "the migrate subcommand requires -storage=postgres")
+			os.Exit(2)
 		}
-	}()
 
-	logger.PrintInfo("database connection pool established", nil)
+		model = data.NewMemoryModel()
+		logger.PrintInfo("storing records in memory, they are lost on exit", nil)
+
+		if cfg.memory.adminEmail != "" {
+			err := createAdmin(context.Background(), model, cfg.memory.adminEmail, cfg.memory.adminPassword)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+
+			logger.PrintInfo("created the admin user", map[string]string{"email": cfg.memory.adminEmail})
+		}
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown storage: %s", cfg.storage), nil)
+	}
 
 	app := &application{
 		config: cfg,
 		logger: logger,
-		model:  data.NewModel(db),
+		model:  model,
+		mailer: mailer.New(newMailBackend(cfg), cfg.smtp.sender),
+		done:   make(chan struct{}),
+	}
+
+	app.startScheduler()
+
+	serveErr := app.serve()
+
+	if db != nil {
+		err := db.Close()
+		if err != nil {
+			logger.PrintError(err, nil)
+		} else {
+			logger.PrintInfo("database connection pool closed", nil)
+		}
+	}
+
+	if serveErr != nil {
+		logger.PrintFatal(serveErr, nil)
+	}
+}
+
+// openPostgres connects to the database, and makes sure its schema is up to
+// date unless outdated schemas are allowed. When the command line holds the
+// migrate subcommand, it runs it and exits instead.
+func openPostgres(cfg config, logger *jsonlog.Logger) *sql.DB {
+	db, err := openDB(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	logger.PrintInfo("database connection pool established", nil)
+
+	migrator, err := newMigrator(db, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// api [flags] migrate ... runs the migrations instead of the server.
+	if flag.NArg() > 0 {
+		if flag.Arg(0) != "migrate" {
+			fmt.Fprintln(os.Stderr, errMigrateUsage)
+			os.Exit(2)
+		}
+
+		err = runMigrate(context.Background(), migrator, flag.Args()[1:], os.Stdout)
+		db.Close()
+
+		if errors.Is(err, errMigrateUsage) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		os.Exit(0)
+	}
+
+	err = migrator.Check(context.Background())
+	if err != nil {
+		if !cfg.db.allowOutdatedSchema || !errors.Is(err, migrate.ErrSchemaBehind) {
+			logger.PrintFatal(err, map[string]string{"hint": "run the migrate subcommand"})
+		}
+		logger.PrintInfo("starting with an outdated database schema", map[string]string{"error": err.Error()})
+	}
+
+	return db
+}
+
+// createAdmin stores an activated user holding every permission, the admin
+// one included.
+func createAdmin(ctx context.Context, model data.Model, email, password string) error {
+	user := &data.User{Name: "Admin", Email: email, Activated: true}
+
+	err := user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		return fmt.Errorf("invalid admin user: %v", v.Errors)
+	}
+
+	err = model.User.Insert(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	codes := append([]string{data.PermissionAdmin}, data.GrantablePermissions...)
+
+	return model.Permission.AddForUser(ctx, user.ID, codes...)
+}
+
+// newMailBackend returns the file-drop backend when a mail directory is
+// configured and the SMTP backend otherwise.
+func newMailBackend(cfg config) mailer.Backend {
+	if cfg.mailDir != "" {
+		return mailer.FileBackend{Dir: cfg.mailDir}
 	}
 
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.port),
-		Handler: app.routes(),
+	return mailer.SMTPBackend{
+		Host:     cfg.smtp.host,
+		Port:     cfg.smtp.port,
+		Username: cfg.smtp.username,
+		Password: cfg.smtp.password,
 	}
-	logger.PrintFatal(srv.ListenAndServe(), nil)
 }
 
 func openDB(cfg config) (*sql.DB, error) {
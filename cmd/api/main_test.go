@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"reflect"
+	"testing"
+)
+
+func TestCreateAdmin(t *testing.T) {
+	model := data.NewMemoryModel()
+
+	err := createAdmin(context.Background(), model, "admin@example.com", "pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := model.User.GetByEmail(context.Background(), "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.Activated {
+		t.Error("Activated -> want: true; got: false")
+	}
+
+	if match, _ := user.Password.Matches("pa55word1234"); !match {
+		t.Error("Password -> want the password to match")
+	}
+
+	permissions, err := model.Permission.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := data.Permissions{data.PermissionAdmin, data.PermissionBlogsRead, data.PermissionBlogsWrite,
+		data.PermissionCommentsModerate}
+	if !reflect.DeepEqual(permissions, want) {
+		t.Errorf("Permissions -> want: %v; got: %v", want, permissions)
+	}
+
+	err = createAdmin(context.Background(), model, "admin", "pa55word1234")
+	if err == nil {
+		t.Error("Invalid Email -> want an error")
+	}
+
+	err = createAdmin(context.Background(), model, "admin@example.com", "pa55word1234")
+	if err == nil {
+		t.Error("Duplicate Email -> want an error")
+	}
+}
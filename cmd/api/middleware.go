@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/validator"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
 )
@@ -34,10 +38,18 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		clients = make(map[string]*client)
 	)
 
+	// Forget clients that haven't been seen recently, until the
+	// application shuts down.
 	go func() {
-		for {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
 
-			time.Sleep(time.Minute)
+		for {
+			select {
+			case <-ticker.C:
+			case <-app.done:
+				return
+			}
 
 			mu.Lock()
 
@@ -83,6 +95,101 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	})
 }
 
-// TODO: authentication
-// TODO: requireAuthenticatedUser
-// TODO: requireActivatedUser
+// authenticate stores the user owning the bearer token from the Authorization
+// header in the request context, or data.AnonymousUser if no header is sent.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response varies with the Authorization header, so caches
+		// must not share it between users.
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.model.User.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAuthenticatedUser rejects requests made by the anonymous user.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireActivatedUser rejects requests made by anonymous or not yet activated users.
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requirePermission rejects requests made by users without the given permission code.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.model.Permission.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
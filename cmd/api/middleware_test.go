@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	token := newToken(t, model, mock.User.ID, time.Hour, data.ScopeAuthentication)
+	expired := newToken(t, model, mock.User.ID, -time.Hour, data.ScopeAuthentication)
+	activation := newToken(t, model, mock.User.ID, time.Hour, data.ScopeActivation)
+
+	invalidToken := "{\n\t\"error\": \"invalid or missing authentication token\"\n}\n"
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+		wantBody      string
+		wantUserID    int64
+	}{
+		{name: "No Header", wantCode: http.StatusOK},
+		{name: "Valid Token", authorization: "Bearer " + token, wantCode: http.StatusOK,
+			wantUserID: mock.User.ID},
+		{name: "Expired Token", authorization: "Bearer " + expired, wantCode: http.StatusUnauthorized,
+			wantBody: invalidToken},
+		{name: "Wrong Scope", authorization: "Bearer " + activation, wantCode: http.StatusUnauthorized,
+			wantBody: invalidToken},
+		{name: "Malformed Token", authorization: "Bearer abc", wantCode: http.StatusUnauthorized,
+			wantBody: invalidToken},
+		{name: "Not Bearer", authorization: "Basic " + token, wantCode: http.StatusUnauthorized,
+			wantBody: invalidToken},
+		{name: "Missing Token", authorization: "Bearer", wantCode: http.StatusUnauthorized,
+			wantBody: invalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user *data.User
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user = app.contextGetUser(r)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/blogs", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			app.authenticate(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if w.Code != http.StatusOK {
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+				}
+				if user != nil {
+					t.Error("Next -> want the handler not to be called")
+				}
+				return
+			}
+
+			switch {
+			case user == nil:
+				t.Error("Next -> want the handler to be called")
+			case tt.wantUserID == 0 && !user.IsAnonymous():
+				t.Errorf("User -> want: anonymous; got: %d", user.ID)
+			case tt.wantUserID != 0 && user.ID != tt.wantUserID:
+				t.Errorf("User -> want: %d; got: %d", tt.wantUserID, user.ID)
+			}
+
+			if got := w.Header().Get("Vary"); got != "Authorization" {
+				t.Errorf("Vary -> want: Authorization; got: %q", got)
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	inactive := insertUser(t, model, "ferris@example.com", false)
+	reader := insertUser(t, model, "crab@example.com", true)
+
+	err := model.Permission.AddForUser(context.Background(), reader.ID, data.PermissionBlogsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticationRequired := "{\n\t\"error\": \"you must be authenticated to access this resource\"\n}\n"
+	inactiveAccount := "{\n\t\"error\": \"your user account must be activated to access this resource\"\n}\n"
+	notPermitted := "{\n\t\"error\": \"your user account doesn't have the necessary permissions to access this resource\"\n}\n"
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	requireBlogsWrite := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.requirePermission(data.PermissionBlogsWrite, next)
+	}
+
+	tests := []struct {
+		name       string
+		middleware func(http.HandlerFunc) http.HandlerFunc
+		user       *data.User
+		wantCode   int
+		wantBody   string
+	}{
+		{name: "Authenticated Anonymous", middleware: app.requireAuthenticatedUser, user: data.AnonymousUser,
+			wantCode: http.StatusUnauthorized, wantBody: authenticationRequired},
+		{name: "Authenticated Inactive", middleware: app.requireAuthenticatedUser, user: inactive,
+			wantCode: http.StatusOK},
+		{name: "Activated Anonymous", middleware: app.requireActivatedUser, user: data.AnonymousUser,
+			wantCode: http.StatusUnauthorized, wantBody: authenticationRequired},
+		{name: "Activated Inactive", middleware: app.requireActivatedUser, user: inactive,
+			wantCode: http.StatusForbidden, wantBody: inactiveAccount},
+		{name: "Activated Active", middleware: app.requireActivatedUser, user: reader,
+			wantCode: http.StatusOK},
+		{name: "Permission Anonymous", middleware: requireBlogsWrite, user: data.AnonymousUser,
+			wantCode: http.StatusUnauthorized, wantBody: authenticationRequired},
+		{name: "Permission Inactive", middleware: requireBlogsWrite, user: inactive,
+			wantCode: http.StatusForbidden, wantBody: inactiveAccount},
+		{name: "Permission Missing", middleware: requireBlogsWrite, user: reader,
+			wantCode: http.StatusForbidden, wantBody: notPermitted},
+		{name: "Permission Granted", middleware: requireBlogsWrite, user: mock.User,
+			wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/blogs", nil)
+			r = app.contextSetUser(r, tt.user)
+
+			tt.middleware(ok)(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	"github.com/3n0ugh/BasedWeb/internal/migrate"
+	"github.com/3n0ugh/BasedWeb/migrations"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var errMigrateUsage = errors.New("usage: api [flags] migrate up | down N | status | goto V | force V")
+
+func newMigrator(db *sql.DB, logger *jsonlog.Logger) (*migrate.Migrator, error) {
+	files, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, files, logger), nil
+}
+
+// runMigrate runs the migrate subcommand given by args, which follow the
+// "migrate" argument. It returns errMigrateUsage for unknown commands.
+func runMigrate(ctx context.Context, m *migrate.Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	// down, goto and force take a single number.
+	var n int64
+
+	switch args[0] {
+	case "up", "status":
+		if len(args) != 1 {
+			return errMigrateUsage
+		}
+	case "down", "goto", "force":
+		if len(args) != 2 {
+			return errMigrateUsage
+		}
+
+		var err error
+
+		n, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || n < 0 || (n == 0 && args[0] == "down") {
+			return errMigrateUsage
+		}
+	default:
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx, int(n))
+	case "goto":
+		return m.Goto(ctx, n)
+	case "force":
+		return m.Force(ctx, n)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	printMigrationStatus(out, statuses)
+
+	return nil
+}
+
+func printMigrationStatus(out io.Writer, statuses []migrate.Status) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT\tNOTE")
+
+	for _, s := range statuses {
+		appliedAt, note := "pending", ""
+
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		if s.Modified {
+			note = "modified since applied"
+		}
+
+		fmt.Fprintf(tw, "%06d\t%s\t%s\t%s\n", s.Version, s.Name, appliedAt, note)
+	}
+
+	tw.Flush()
+}
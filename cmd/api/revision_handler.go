@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/diff"
+	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"net/http"
+)
+
+// listRevisionsHandler lists a page of the versions of a blog, newest first
+// unless sorted otherwise.
+func (app *application) listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		data.Filter
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+
+	input.Filter.Page = app.readInt(query, "page", 1, v)
+	input.Filter.PageSize = app.readInt(query, "page_size", 20, v)
+	input.Filter.Sort = app.readString(query, "sort", "-version")
+
+	input.Filter.SortSafeList = []string{"version", "-version"}
+
+	if data.ValidateFilter(v, input.Filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, ok := app.readVisibleBlog(w, r, id); !ok {
+		return
+	}
+
+	revisions, metadata, err := app.model.Revision.GetAll(r.Context(), id, input.Filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := app.paginationLinks(r, &metadata)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	version, err := app.readParamVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	blog, ok := app.readVisibleBlog(w, r, id)
+	if !ok {
+		return
+	}
+
+	revision, err := app.blogRevision(r.Context(), blog, version)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffRevisionsHandler compares two versions of a blog line by line. The
+// "to" version defaults to the current one.
+func (app *application) diffRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamID(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	blog, ok := app.readVisibleBlog(w, r, id)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+
+	from := app.readInt(query, "from", 0, v)
+	to := app.readInt(query, "to", int(blog.Version), v)
+
+	v.Check(from > 0, "from", "must be provided and greater than zero")
+	v.Check(to > 0, "to", "must be greater than zero")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if from >= to {
+		app.badRequestResponse(w, r, errors.New("the from version must be lower than the to version"))
+		return
+	}
+
+	var revisions [2]*data.Revision
+
+	for i, version := range []int{from, to} {
+		revisions[i], err = app.blogRevision(r.Context(), blog, int32(version))
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.notFoundResponse(w, r)
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	old, cur := revisions[0], revisions[1]
+
+	env := envelope{"diff": map[string]interface{}{
+		"from":     old.Version,
+		"to":       cur.Version,
+		"title":    diff.Text(old.Title, cur.Title),
+		"body":     diff.Text(old.Body, cur.Body),
+		"category": diff.Lines(old.Category, cur.Category),
+	}}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreRevisionHandler copies the content of an earlier version into the
+// blog, which stores it as a new version.
+func (app *application) restoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := app.readParamVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	blog, ok := app.readBlogForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	revision, err := app.blogRevision(r.Context(), blog, version)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	blog.Title = revision.Title
+	blog.Body = revision.Body
+	blog.Category = revision.Category
+
+	app.saveBlog(w, r, blog)
+}
+
+// readVisibleBlog loads the blog and responds with 404 if the user may not
+// see it. If it returns false, the error response has already been sent.
+func (app *application) readVisibleBlog(w http.ResponseWriter, r *http.Request, id int64) (*data.Blog, bool) {
+	blog, err := app.model.Blog.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	ok, err := app.canViewBlog(r.Context(), app.contextGetUser(r), blog)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !ok {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return blog, true
+}
+
+// blogRevision returns the given version of the blog, which is either its
+// current content or a stored prior version.
+func (app *application) blogRevision(ctx context.Context, blog *data.Blog, version int32) (*data.Revision, error) {
+	if version == blog.Version {
+		return data.CurrentRevision(blog), nil
+	}
+
+	return app.model.Revision.Get(ctx, blog.ID, version)
+}
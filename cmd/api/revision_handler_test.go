@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestListRevisionsHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name         string
+		param        string
+		query        string
+		wantCode     int
+		wantVersions []int32
+	}{
+		{name: "Must Success", param: "1", wantCode: http.StatusOK, wantVersions: []int32{2, 1}},
+		{name: "Oldest First", param: "1", query: "?sort=version", wantCode: http.StatusOK,
+			wantVersions: []int32{1, 2}},
+		{name: "Second Page", param: "1", query: "?page=2&page_size=1", wantCode: http.StatusOK,
+			wantVersions: []int32{1}},
+		{name: "Invalid Sort", param: "1", query: "?sort=title", wantCode: http.StatusUnprocessableEntity},
+		{name: "Page Too Large", param: "1", query: "?page_size=101", wantCode: http.StatusUnprocessableEntity},
+		{name: "Non-existent ID", param: "2", wantCode: http.StatusNotFound},
+		{name: "Negative ID", param: "-1", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs/"+tt.param+"/revisions"+tt.query, nil,
+				httprouter.Params{{Key: "id", Value: tt.param}})
+
+			app.listRevisionsHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantVersions == nil {
+				return
+			}
+
+			var got struct {
+				Revisions []data.Revision `json:"revisions"`
+			}
+
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var versions []int32
+			for _, revision := range got.Revisions {
+				versions = append(versions, revision.Version)
+			}
+
+			if !reflect.DeepEqual(versions, tt.wantVersions) {
+				t.Errorf("Versions -> want: %v; got: %v", tt.wantVersions, versions)
+			}
+		})
+	}
+}
+
+func TestShowRevisionHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name      string
+		id        string
+		version   string
+		wantCode  int
+		wantTitle string
+	}{
+		{name: "Prior Version", id: "1", version: "1", wantCode: http.StatusOK, wantTitle: mock.OldTitle},
+		{name: "Current Version", id: "1", version: "2", wantCode: http.StatusOK, wantTitle: mock.Blog.Title},
+		{name: "Unknown Version", id: "1", version: "3", wantCode: http.StatusNotFound},
+		{name: "Invalid Version", id: "1", version: "0", wantCode: http.StatusBadRequest},
+		{name: "Non-existent ID", id: "2", version: "1", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs/"+tt.id+"/revisions/"+tt.version, nil,
+				httprouter.Params{{Key: "id", Value: tt.id}, {Key: "version", Value: tt.version}})
+
+			app.showRevisionHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantTitle == "" {
+				return
+			}
+
+			var got struct {
+				Revision data.Revision `json:"revision"`
+			}
+
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Revision.Title != tt.wantTitle {
+				t.Errorf("Title -> want: %q; got: %q", tt.wantTitle, got.Revision.Title)
+			}
+		})
+	}
+}
+
+func TestDiffRevisionsHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+	}{
+		{name: "To Current Version", query: "?from=1", wantCode: http.StatusOK},
+		{name: "Both Versions", query: "?from=1&to=2", wantCode: http.StatusOK},
+		{name: "Reversed Range", query: "?from=2&to=1", wantCode: http.StatusBadRequest},
+		{name: "Empty Range", query: "?from=2&to=2", wantCode: http.StatusBadRequest},
+		{name: "Unknown Version", query: "?from=1&to=3", wantCode: http.StatusNotFound},
+		{name: "Missing From", query: "", wantCode: http.StatusUnprocessableEntity},
+		{name: "Invalid From", query: "?from=first", wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodGet, "/v1/blogs/1/diff"+tt.query, nil,
+				httprouter.Params{{Key: "id", Value: "1"}})
+
+			app.diffRevisionsHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestRestoreRevisionHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		user     *data.User
+		wantCode int
+	}{
+		{name: "Must Success", version: "1", user: mock.User, wantCode: http.StatusOK},
+		{name: "Unknown Version", version: "3", user: mock.User, wantCode: http.StatusNotFound},
+		{name: "Invalid Version", version: "v1", user: mock.User, wantCode: http.StatusBadRequest},
+		{name: "Not Author", version: "1", user: &data.User{ID: 8, Name: "Stranger", Activated: true},
+			wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(mock.NewModel())
+
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/blogs/1/revisions/"+tt.version+"/restore", nil,
+				httprouter.Params{{Key: "id", Value: "1"}, {Key: "version", Value: tt.version}})
+			r = app.contextSetUser(r, tt.user)
+
+			app.restoreRevisionHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			// Restoring goes through Update, so the restored content is a
+			// new version and the replaced one is kept as a revision.
+			blog, err := app.model.Blog.Get(r.Context(), mock.Blog.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if blog.Title != mock.OldTitle || blog.Version != mock.Blog.Version+1 {
+				t.Errorf("Blog -> want: %q version %d; got: %q version %d",
+					mock.OldTitle, mock.Blog.Version+1, blog.Title, blog.Version)
+			}
+
+			revision, err := app.model.Revision.Get(r.Context(), mock.Blog.ID, mock.Blog.Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if revision.Title != mock.Blog.Title {
+				t.Errorf("Revision Title -> want: %q; got: %q", mock.Blog.Title, revision.Title)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"github.com/3n0ugh/BasedWeb/internal/data"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"strings"
 )
 
 func (app *application) routes() http.Handler {
@@ -13,11 +15,62 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/health-check", app.HealthCheckHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/blogs", app.createBlogHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/blogs",
+		app.requirePermission(data.PermissionBlogsWrite, app.createBlogHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/blogs", app.listBlogHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/blogs/:id", app.showBlogHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/blogs/:id", app.deleteBlogHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/blogs/:id", app.updateBlogHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/blogs/:id",
+		app.requirePermission(data.PermissionBlogsWrite, app.deleteBlogHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/blogs/:id",
+		app.requirePermission(data.PermissionBlogsWrite, app.updateBlogHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/blogs/:id",
+		app.requirePermission(data.PermissionBlogsWrite, app.patchBlogHandler))
 
-	return app.logRequest(router)
+	router.HandlerFunc(http.MethodGet, "/v1/blogs/:id/revisions", app.listRevisionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/blogs/:id/revisions/:version", app.showRevisionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/blogs/:id/diff", app.diffRevisionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/blogs/:id/revisions/:version/restore",
+		app.requirePermission(data.PermissionBlogsWrite, app.restoreRevisionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/blogs/:id/comments", app.listCommentsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/blogs/:id/comments",
+		app.requireActivatedUser(app.createCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/comments/:id",
+		app.requireActivatedUser(app.deleteCommentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/comments/moderation",
+		app.requirePermission(data.PermissionCommentsModerate, app.listModerationQueueHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/comments/moderation/approve",
+		app.requirePermission(data.PermissionCommentsModerate, app.approveCommentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/comments/moderation/reject",
+		app.requirePermission(data.PermissionCommentsModerate, app.rejectCommentsHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/:id/permissions",
+		app.requirePermission(data.PermissionAdmin, app.grantPermissionsHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	// httprouter can't register the static by-slug segment next to the :id
+	// wildcard, so slug lookups get a router of their own.
+	slugRouter := httprouter.New()
+
+	slugRouter.NotFound = router.NotFound
+	slugRouter.MethodNotAllowed = router.MethodNotAllowed
+
+	slugRouter.HandlerFunc(http.MethodGet, "/v1/blogs/by-slug/:slug", app.showBlogBySlugHandler)
+
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/blogs/by-slug/") {
+			slugRouter.ServeHTTP(w, r)
+			return
+		}
+		router.ServeHTTP(w, r)
+	})
+
+	return app.logRequest(app.authenticate(mux))
 }
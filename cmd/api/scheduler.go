@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// startScheduler publishes scheduled blogs once their publish time has come.
+// It runs as a background task, so shutdown waits for the current run, whose
+// queries are cancelled once the shutdown starts.
+func (app *application) startScheduler() {
+	app.background(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go func() {
+			select {
+			case <-app.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		ticker := time.NewTicker(app.config.scheduler.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-app.done:
+				return
+			}
+
+			n, err := app.model.Blog.PublishScheduled(ctx)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			if n > 0 {
+				app.logger.PrintInfo("published scheduled blogs", map[string]string{
+					"count": strconv.FormatInt(n, 10),
+				})
+			}
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"testing"
+	"time"
+)
+
+func TestStartScheduler(t *testing.T) {
+	model := mock.NewModel()
+
+	app := NewTestApplication(model)
+	app.config.scheduler.interval = 10 * time.Millisecond
+	app.done = make(chan struct{})
+
+	publishAt := time.Now().Add(-time.Minute)
+	due := &data.Blog{Title: "gRPC streaming", Body: "I do not know yet", Category: []string{"Golang"},
+		Status: data.StatusScheduled, PublishAt: &publishAt}
+
+	err := model.Blog.Insert(context.Background(), due)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.startScheduler()
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		blog, err := model.Blog.Get(context.Background(), due.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if blog.Status == data.StatusPublished {
+			if blog.Version != due.Version+1 {
+				t.Errorf("Version -> want: %d; got: %d", due.Version+1, blog.Version)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Status -> want: %s; got: %s", data.StatusPublished, blog.Status)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Shutting down stops the loop, which the drain waits for.
+	close(app.done)
+
+	err = app.waitBackground(time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// serve runs the HTTP server until it receives SIGINT or SIGTERM, then shuts it
+// down gracefully: in-flight requests are completed, the maintenance goroutines
+// are stopped and background tasks are drained.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:     fmt.Sprintf(":%d", app.config.port),
+		Handler:  app.routes(),
+		ErrorLog: log.New(app.logger, "", 0),
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		s := <-quit
+
+		app.logger.PrintInfo("shutting down server", map[string]string{
+			"signal": s.String(),
+		})
+
+		close(app.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": srv.Addr,
+		})
+
+		shutdownError <- app.waitBackground(app.config.background.drainTimeout)
+	}()
+
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": srv.Addr,
+	})
+
+	// Shutdown makes ListenAndServe return http.ErrServerClosed right away,
+	// so that error means the graceful shutdown has started.
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("stopped server", map[string]string{
+		"addr": srv.Addr,
+	})
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"github.com/3n0ugh/BasedWeb/internal/mailer"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateAuthenticationTokenHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	invalidCredentials := "{\n\t\"error\": \"invalid authentication credentials\"\n}\n"
+
+	tests := []struct {
+		name     string
+		reqBody  string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Must Success", reqBody: `{"email": "gopher@example.com", "password": "` + mock.Password + `"}`,
+			wantCode: http.StatusCreated},
+		{name: "Wrong Password", reqBody: `{"email": "gopher@example.com", "password": "wr0ngpa55word"}`,
+			wantCode: http.StatusUnauthorized, wantBody: invalidCredentials},
+		{name: "Unknown Email", reqBody: `{"email": "ferris@example.com", "password": "` + mock.Password + `"}`,
+			wantCode: http.StatusUnauthorized, wantBody: invalidCredentials},
+		{name: "Invalid Email", reqBody: `{"email": "gopher", "password": "` + mock.Password + `"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"email\": \"must be valid email address\"\n\t}\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/tokens/authentication", []byte(tt.reqBody), nil)
+
+			app.createAuthenticationTokenHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantBody != "" {
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+				}
+				return
+			}
+
+			var got struct {
+				Token data.Token `json:"authentication_token"`
+			}
+
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := app.model.User.GetForToken(context.Background(), data.ScopeAuthentication, got.Token.Plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.ID != mock.User.ID {
+				t.Errorf("User -> want: %d; got: %d", mock.User.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestCreatePasswordResetTokenHandler(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	mail := &sentMail{}
+	app.mailer = mailer.New(mail, "BasedWeb <no-reply@basedweb.local>")
+
+	insertUser(t, model, "ferris@example.com", false)
+
+	// The answer must not tell which addresses belong to activated accounts.
+	accepted := "{\n\t\"message\": \"if an activated account with that email address exists, " +
+		"you will receive password reset instructions shortly\"\n}\n"
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Activated User", email: "gopher@example.com", wantCode: http.StatusAccepted, wantBody: accepted},
+		{name: "Inactive User", email: "ferris@example.com", wantCode: http.StatusAccepted, wantBody: accepted},
+		{name: "Unknown Email", email: "crab@example.com", wantCode: http.StatusAccepted, wantBody: accepted},
+		{name: "Invalid Email", email: "gopher", wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"email\": \"must be valid email address\"\n\t}\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/tokens/password-reset",
+				[]byte(`{"email": "`+tt.email+`"}`), nil)
+
+			app.createPasswordResetTokenHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	err := app.waitBackground(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := mail.recipients(); !reflect.DeepEqual(got, []string{"gopher@example.com"}) {
+		t.Errorf("Recipients -> want: [gopher@example.com]; got: %v", got)
+	}
+}
+
+func TestCreateActivationTokenHandler(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	mail := &sentMail{}
+	app.mailer = mailer.New(mail, "BasedWeb <no-reply@basedweb.local>")
+
+	inactive := insertUser(t, model, "ferris@example.com", false)
+
+	// The answer must not tell which addresses belong to accounts waiting
+	// for activation.
+	accepted := "{\n\t\"message\": \"if an account waiting for activation exists for that email address, " +
+		"you will receive activation instructions shortly\"\n}\n"
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Inactive User", email: "ferris@example.com", wantCode: http.StatusAccepted, wantBody: accepted},
+		{name: "Activated User", email: "gopher@example.com", wantCode: http.StatusAccepted, wantBody: accepted},
+		{name: "Unknown Email", email: "crab@example.com", wantCode: http.StatusAccepted, wantBody: accepted},
+		{name: "Invalid Email", email: "ferris", wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"email\": \"must be valid email address\"\n\t}\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/tokens/activation",
+				[]byte(`{"email": "`+tt.email+`"}`), nil)
+
+			app.createActivationTokenHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d", tt.wantCode, w.Code)
+			}
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	err := app.waitBackground(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := mail.recipients(); !reflect.DeepEqual(got, []string{inactive.Email}) {
+		t.Errorf("Recipients -> want: [%s]; got: %v", inactive.Email, got)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/mock"
+	"github.com/3n0ugh/BasedWeb/internal/mailer"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// insertUser stores a user without a password, for tests that only need it
+// to own tokens or permissions.
+func insertUser(t *testing.T, model data.Model, email string, activated bool) *data.User {
+	user := &data.User{Name: "Gopher", Email: email, Activated: activated}
+
+	err := model.User.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func newToken(t *testing.T, model data.Model, userID int64, ttl time.Duration, scope string) string {
+	token, err := model.Token.New(context.Background(), userID, ttl, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token.Plaintext
+}
+
+func TestRegisterUserHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	mail := &sentMail{}
+	app.mailer = mailer.New(mail, "BasedWeb <no-reply@basedweb.local>")
+
+	tests := []struct {
+		name     string
+		reqBody  string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Must Success", reqBody: `{"name": "Ferris", "email": "ferris@example.com", "password": "pa55word1234"}`,
+			wantCode: http.StatusCreated},
+		{name: "Duplicate Email", reqBody: `{"name": "Gopher", "email": "gopher@example.com", "password": "pa55word1234"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"email\": \"a user with this email address already exists\"\n\t}\n}\n"},
+		{name: "Short Password", reqBody: `{"name": "Ferris", "email": "crab@example.com", "password": "pa55"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"password\": \"must be at least 8 bytes long\"\n\t}\n}\n"},
+		{name: "Invalid Email", reqBody: `{"name": "Ferris", "email": "crab", "password": "pa55word1234"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"email\": \"must be valid email address\"\n\t}\n}\n"},
+		{name: "Unknown Field", reqBody: `{"name": "Ferris", "admin": true}`,
+			wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/users", []byte(tt.reqBody), nil)
+
+			app.registerUserHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	err := app.waitBackground(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := mail.recipients(); !reflect.DeepEqual(got, []string{"ferris@example.com"}) {
+		t.Errorf("Recipients -> want: [ferris@example.com]; got: %v", got)
+	}
+
+	user, err := app.model.User.GetByEmail(context.Background(), "ferris@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Activated {
+		t.Error("Activated -> want: false; got: true")
+	}
+
+	permissions, err := app.model.Permission.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(permissions, data.Permissions{data.PermissionBlogsRead}) {
+		t.Errorf("Permissions -> want: [%s]; got: %v", data.PermissionBlogsRead, permissions)
+	}
+}
+
+func TestActivateUserHandler(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	user := insertUser(t, model, "ferris@example.com", false)
+
+	token := newToken(t, model, user.ID, time.Hour, data.ScopeActivation)
+	expired := newToken(t, model, user.ID, -time.Hour, data.ScopeActivation)
+	wrongScope := newToken(t, model, user.ID, time.Hour, data.ScopePasswordReset)
+
+	invalidToken := "{\n\t\"error\": {\n\t\t\"token\": \"invalid or expired activation token\"\n\t}\n}\n"
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Expired Token", token: expired, wantCode: http.StatusUnprocessableEntity, wantBody: invalidToken},
+		{name: "Wrong Scope", token: wrongScope, wantCode: http.StatusUnprocessableEntity, wantBody: invalidToken},
+		{name: "Malformed Token", token: "abc", wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"token\": \"must be 26 bytes long\"\n\t}\n}\n"},
+		{name: "Must Success", token: token, wantCode: http.StatusOK},
+		{name: "Used Token", token: token, wantCode: http.StatusUnprocessableEntity, wantBody: invalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPut, "/v1/users/activated", []byte(`{"token": "`+tt.token+`"}`), nil)
+
+			app.activateUserHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	user, err := model.User.GetByEmail(context.Background(), user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.Activated {
+		t.Error("Activated -> want: true; got: false")
+	}
+}
+
+func TestUpdateUserPasswordHandler(t *testing.T) {
+	model := mock.NewModel()
+	app := NewTestApplication(model)
+
+	resetToken := newToken(t, model, mock.User.ID, time.Hour, data.ScopePasswordReset)
+	authToken := newToken(t, model, mock.User.ID, time.Hour, data.ScopeAuthentication)
+
+	invalidToken := "{\n\t\"error\": {\n\t\t\"token\": \"invalid or expired password reset token\"\n\t}\n}\n"
+
+	tests := []struct {
+		name     string
+		reqBody  string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Short Password", reqBody: `{"password": "pa55", "token": "` + resetToken + `"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"password\": \"must be at least 8 bytes long\"\n\t}\n}\n"},
+		{name: "Unknown Token", reqBody: `{"password": "n3wpa55word", "token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}`,
+			wantCode: http.StatusUnprocessableEntity, wantBody: invalidToken},
+		{name: "Must Success", reqBody: `{"password": "n3wpa55word", "token": "` + resetToken + `"}`,
+			wantCode: http.StatusOK,
+			wantBody: "{\n\t\"message\": \"your password was successfully reset\"\n}\n"},
+		{name: "Used Token", reqBody: `{"password": "n3wpa55word", "token": "` + resetToken + `"}`,
+			wantCode: http.StatusUnprocessableEntity, wantBody: invalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPut, "/v1/users/password", []byte(tt.reqBody), nil)
+
+			app.updateUserPasswordHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	_, err := model.User.GetForToken(context.Background(), data.ScopeAuthentication, authToken)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("Authentication Token -> want: %v; got: %v", data.ErrRecordNotFound, err)
+	}
+
+	user, err := model.User.GetByEmail(context.Background(), mock.User.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if match, _ := user.Password.Matches("n3wpa55word"); !match {
+		t.Error("Password -> want the new password to match")
+	}
+}
+
+func TestGrantPermissionsHandler(t *testing.T) {
+	app := NewTestApplication(mock.NewModel())
+
+	tests := []struct {
+		name     string
+		param    string
+		reqBody  string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Must Success", param: "1", reqBody: `{"permissions": ["comments:moderate"]}`,
+			wantCode: http.StatusOK,
+			wantBody: "{\n\t\"permissions\": [\n\t\t\"blogs:read\",\n\t\t\"blogs:write\",\n\t\t\"comments:moderate\"\n\t]\n}\n"},
+		{name: "Already Granted", param: "1", reqBody: `{"permissions": ["blogs:read"]}`,
+			wantCode: http.StatusOK,
+			wantBody: "{\n\t\"permissions\": [\n\t\t\"blogs:read\",\n\t\t\"blogs:write\",\n\t\t\"comments:moderate\"\n\t]\n}\n"},
+		{name: "Not Grantable", param: "1", reqBody: `{"permissions": ["admin"]}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"permissions\": \"must only contain grantable permission codes\"\n\t}\n}\n"},
+		{name: "No Permissions", param: "1", reqBody: `{"permissions": []}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "{\n\t\"error\": {\n\t\t\"permissions\": \"must contain at least 1 permission\"\n\t}\n}\n"},
+		{name: "Non-existent ID", param: "2", reqBody: `{"permissions": ["blogs:write"]}`,
+			wantCode: http.StatusNotFound,
+			wantBody: "{\n\t\"error\": \"the requested resource could not be found\"\n}\n"},
+		{name: "Negative ID", param: "-1", reqBody: `{"permissions": ["blogs:write"]}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\n\t\"error\": \"invalid id parameter\"\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := NewRequestWithContext(http.MethodPost, "/v1/users/"+tt.param+"/permissions", []byte(tt.reqBody),
+				httprouter.Params{{Key: "id", Value: tt.param}})
+
+			app.grantPermissionsHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Status Code -> want: %d; got: %d; body: %s", tt.wantCode, w.Code, w.Body)
+			}
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Body -> want: %q; got: %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
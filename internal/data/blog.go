@@ -7,21 +7,96 @@ import (
 	"fmt"
 	"github.com/3n0ugh/BasedWeb/internal/validator"
 	"github.com/lib/pq"
+	"html"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type Blog struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Body      string    `json:"body"`
-	Category  []string  `json:"category"`
-	Version   int32     `json:"version,omitempty"`
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"-"`
+	Title     string     `json:"title"`
+	Slug      string     `json:"slug"`
+	Body      string     `json:"body"`
+	Category  []string   `json:"category"`
+	Author    *Author    `json:"author,omitempty"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	Version   int32      `json:"version,omitempty"`
+	// Snippet highlights the matches of a search in the body. It is only
+	// set by GetAll when searching.
+	Snippet string `json:"snippet,omitempty"`
+}
+
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// BlogStatuses lists the lifecycle states of a blog. Only published blogs
+// are visible to everyone; scheduled ones are published by the scheduler
+// once their PublishAt time has come.
+var BlogStatuses = []string{StatusDraft, StatusScheduled, StatusPublished, StatusArchived}
+
+// Author is the public part of the user who wrote a blog. Blogs created
+// before authorship was tracked have no author.
+type Author struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// IsAuthor returns true if the user with the given id wrote the blog.
+func (b *Blog) IsAuthor(userID int64) bool {
+	return b.Author != nil && b.Author.ID == userID
+}
+
+// BlogCriteria holds the optional conditions GetAll narrows the listing by.
+// Zero values match every blog.
+type BlogCriteria struct {
+	Title    string
+	Category []string
+	AuthorID int64
+	Status   string
+	// Query searches the title and the body of the blogs, with the text
+	// search configuration named by Language, "simple" by default.
+	Query    string
+	Language string
+}
+
+// SearchLanguages lists the text search configurations a search can use.
+// The "simple" one is backed by the stored search vector, the others by
+// expression indexes on the searchVector expression; adding a language takes
+// a migration creating its index.
+var SearchLanguages = []string{"simple", "english", "french", "german", "spanish", "turkish"}
+
+// searchVector returns the SQL for the weighted title and body tsvector in a
+// text search configuration. It must stay in step with the expression of the
+// blogs_search_<language>_idx indexes for them to be used. It panics on
+// configurations not in SearchLanguages, as they are put into the query as
+// is.
+func searchVector(language string) string {
+	if language == "" || language == "simple" {
+		return "blogs.search_vector"
+	}
+
+	for _, l := range SearchLanguages {
+		if language == l {
+			return fmt.Sprintf(`(setweight(to_tsvector('%[1]s', blogs.title), 'A') ||
+				setweight(to_tsvector('%[1]s', blogs.body), 'B'))`, language)
+		}
+	}
+
+	panic("unsafe search language: " + language)
 }
 
 func ValidateBlog(v *validator.Validator, blog *Blog) {
 	v.Check(blog.Title != "", "title", "must be provided")
-	v.Check(len(blog.Title) <= 80, "title", "must not be more than 80 bytes long")
+	v.Check(utf8.RuneCountInString(blog.Title) >= 3, "title", "must be at least 3 characters long")
+	v.Check(utf8.RuneCountInString(blog.Title) <= 70, "title", "must not be more than 70 characters long")
 
 	v.Check(blog.Body != "", "body", "must be provided")
 	v.Check(len(blog.Body) <= 100000, "body", "must not be more than 100000 bytes long")
@@ -30,40 +105,135 @@ func ValidateBlog(v *validator.Validator, blog *Blog) {
 	v.Check(len(blog.Category) >= 1, "category", "must contain at least 1 categories")
 	v.Check(len(blog.Category) <= 5, "category", "must not contain more than 5 categories")
 	v.Check(validator.Unique(blog.Category), "category", "must not contain duplicate categories")
+
+	v.Check(validator.In(blog.Status, BlogStatuses...), "status", "invalid status value")
+	if blog.Status == StatusScheduled {
+		v.Check(blog.PublishAt != nil, "publish_at", "must be provided for scheduled blogs")
+	}
 }
 
 type BlogModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Timeout time.Duration
 }
 
-func (b BlogModel) Insert(blog *Blog) error {
-	query := `INSERT INTO blogs (title, body, category)
-		VALUES ($1, $2, $3)
-        RETURNING id, created_at, version`
+// scanAuthor builds the blog author from the nullable columns of the users join.
+func scanAuthor(id sql.NullInt64, name sql.NullString) *Author {
+	if !id.Valid {
+		return nil
+	}
+	return &Author{ID: id.Int64, Name: name.String}
+}
 
-	args := []interface{}{blog.Title, blog.Body, pq.Array(blog.Category)}
+func scanTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Insert stores the blog along with a unique slug generated from its title.
+func (b BlogModel) Insert(ctx context.Context, blog *Blog) error {
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
 	defer cancel()
 
-	return b.DB.QueryRowContext(ctx, query, args...).
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	blog.Slug, err = b.freeSlug(ctx, tx, Slugify(blog.Title), 0)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO blogs (title, slug, body, category, author_id, status, publish_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, created_at, version`
+
+	var authorID sql.NullInt64
+	if blog.Author != nil {
+		authorID = sql.NullInt64{Int64: blog.Author.ID, Valid: true}
+	}
+
+	args := []interface{}{blog.Title, blog.Slug, blog.Body, pq.Array(blog.Category), authorID,
+		blog.Status, blog.PublishAt}
+
+	err = tx.QueryRowContext(ctx, query, args...).
 		Scan(&blog.ID, &blog.CreatedAt, &blog.Version)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO blog_slugs (slug, blog_id) VALUES ($1, $2)`,
+		blog.Slug, blog.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (b BlogModel) Get(id int64) (*Blog, error) {
-	query := `SELECT created_at, title, body, category, version FROM blogs
-		WHERE id = $1`
+// freeSlug returns base, or base with the lowest free collision suffix, that
+// isn't used by any blog other than blogID now or in the past. Concurrent
+// transactions picking a slug for the same base wait for each other.
+func (b BlogModel) freeSlug(ctx context.Context, tx *sql.Tx, base string, blogID int64) (string, error) {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, base)
+	if err != nil {
+		return "", err
+	}
+
+	query := `SELECT slug FROM blog_slugs
+		WHERE (slug = $1 OR slug LIKE $1 || '-%') AND blog_id <> $2`
+
+	rows, err := tx.QueryContext(ctx, query, base, blogID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+
+	for rows.Next() {
+		var slug string
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err = rows.Scan(&slug)
+		if err != nil {
+			return "", err
+		}
+
+		taken[slug] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	return pickSlug(base, taken), nil
+}
+
+func (b BlogModel) Get(ctx context.Context, id int64) (*Blog, error) {
+	query := `SELECT blogs.created_at, blogs.title, blogs.slug, blogs.body, blogs.category, blogs.version,
+		blogs.status, blogs.publish_at, users.id, users.name
+		FROM blogs
+		LEFT JOIN users ON users.id = blogs.author_id
+		WHERE blogs.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
 	defer cancel()
 
 	var blog Blog
+	var publishAt sql.NullTime
+	var authorID sql.NullInt64
+	var authorName sql.NullString
 
 	blog.ID = id
 
 	row := b.DB.QueryRowContext(ctx, query, id)
 
-	err := row.Scan(&blog.CreatedAt, &blog.Title, &blog.Body, pq.Array(&blog.Category), &blog.Version)
+	err := row.Scan(&blog.CreatedAt, &blog.Title, &blog.Slug, &blog.Body, pq.Array(&blog.Category), &blog.Version,
+		&blog.Status, &publishAt, &authorID, &authorName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
@@ -71,35 +241,109 @@ func (b BlogModel) Get(id int64) (*Blog, error) {
 		return nil, err
 	}
 
+	blog.PublishAt = scanTime(publishAt)
+	blog.Author = scanAuthor(authorID, authorName)
+
 	return &blog, nil
 }
 
-func (b BlogModel) Update(blog *Blog) error {
-	query := `UPDATE blogs
-		SET title = $1, body = $2, category = $3, version = version + 1
-		WHERE id = $4 AND version = $5
+// Update stores the blog if its version is still the one given, and archives
+// the replaced version in blog_revisions within the same transaction.
+func (b BlogModel) Update(ctx context.Context, blog *Blog) error {
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE makes a concurrent update wait for this transaction, after
+	// which the version no longer matches and it gets an edit conflict.
+	query := `INSERT INTO blog_revisions (blog_id, version, title, body, category)
+		SELECT id, version, title, body, category FROM blogs
+		WHERE id = $1 AND version = $2
+		FOR UPDATE`
+
+	res, err := tx.ExecContext(ctx, query, blog.ID, blog.Version)
+	if err != nil {
+		return err
+	}
+
+	archivedRow, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if archivedRow == 0 {
+		return ErrEditConflict
+	}
+
+	// A title change gives the blog a new slug. The old one stays in
+	// blog_slugs, so it keeps resolving to this blog.
+	if base := Slugify(blog.Title); !slugHasBase(blog.Slug, base) {
+		blog.Slug, err = b.freeSlug(ctx, tx, base, blog.ID)
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO blog_slugs (slug, blog_id) VALUES ($1, $2)
+			ON CONFLICT (slug) DO NOTHING`
+
+		_, err = tx.ExecContext(ctx, query, blog.Slug, blog.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `UPDATE blogs
+		SET title = $1, slug = $2, body = $3, category = $4, status = $5, publish_at = $6,
+		version = version + 1
+		WHERE id = $7 AND version = $8
 		RETURNING version`
 
-	args := []interface{}{blog.Title, blog.Body, pq.Array(blog.Category), blog.ID, blog.Version}
+	args := []interface{}{blog.Title, blog.Slug, blog.Body, pq.Array(blog.Category), blog.Status,
+		blog.PublishAt, blog.ID, blog.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&blog.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return constraintError(err)
+	}
+
+	return tx.Commit()
+}
+
+// GetBySlug returns the blog that has, or used to have, the given slug.
+// Callers compare the slug with blog.Slug to tell an outdated one.
+func (b BlogModel) GetBySlug(ctx context.Context, slug string) (*Blog, error) {
+	query := `SELECT blog_id FROM blog_slugs
+		WHERE slug = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
 	defer cancel()
 
-	err := b.DB.QueryRowContext(ctx, query, args).Scan(&blog.Version)
+	var id int64
+
+	err := b.DB.QueryRowContext(ctx, query, slug).Scan(&id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ErrEditConflict
+			return nil, ErrRecordNotFound
 		}
-		return err
+		return nil, err
 	}
-	return nil
+
+	return b.Get(ctx, id)
 }
 
-func (b BlogModel) Delete(id int64) error {
+func (b BlogModel) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM blogs
 		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
 	defer cancel()
 
 	res, err := b.DB.ExecContext(ctx, query, id)
@@ -119,20 +363,92 @@ func (b BlogModel) Delete(id int64) error {
 	return nil
 }
 
-func (b BlogModel) GetAll(title string, category []string, f Filter) ([]*Blog, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, body, category, version
-        FROM blogs
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)
+// blogListQuery selects the listed blogs, with the search vector, the text
+// search configuration, the count expression, the extra condition, the
+// ordering and the paging clause filled in. The criteria are bound to $1 to
+// $5. The page is selected first, so that the snippets are only computed for
+// the blogs on it; the subquery is named blogs for the ordering to apply to
+// both. The matches are marked with the snippetStart and snippetStop
+// sentinels, which scanListedBlog turns into <mark> tags once the snippet is
+// escaped.
+const blogListQuery = `
+		SELECT blogs.total, blogs.id, blogs.created_at, blogs.title, blogs.slug, blogs.body,
+		blogs.category, blogs.version, blogs.status, blogs.publish_at, blogs.author_id,
+		blogs.author_name, blogs.rank,
+		CASE WHEN $5 = '' THEN '' ELSE ts_headline('%[2]s', blogs.body, blogs.search,
+			'StartSel=' || chr(2) || ', StopSel=' || chr(3) ||
+			', MaxWords=35, MinWords=15, MaxFragments=2') END
+		FROM (
+			SELECT %[3]s AS total, blogs.id, blogs.created_at, blogs.title, blogs.slug, blogs.body,
+			blogs.category, blogs.version, blogs.status, blogs.publish_at, users.id AS author_id,
+			users.name AS author_name, search,
+			CASE WHEN $5 = '' THEN 0 ELSE ts_rank_cd(%[1]s, search) END AS rank
+			FROM blogs
+			LEFT JOIN users ON users.id = blogs.author_id
+			CROSS JOIN websearch_to_tsquery('%[2]s', $5) AS search
+			WHERE ` + blogFilters + ` %[4]s
+			ORDER BY %[5]s
+			%[6]s
+		) AS blogs
+		ORDER BY %[5]s`
+
+// snippetStart and snippetStop are the sentinels ts_headline puts around the
+// matches in the snippet.
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// snippetMarks replaces the sentinels of an escaped snippet with <mark> tags.
+var snippetMarks = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// blogFilters narrows the blogs down to the criteria.
+const blogFilters = `(to_tsvector('simple', blogs.title) @@ plainto_tsquery('simple', $1)
 		OR $1 = '')
-        AND (category @> $2 OR $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, f.sortColumn(), f.sortDirection())
+        AND (blogs.category @> $2 OR $2 = '{}')
+        AND (blogs.author_id = $3 OR $3 = 0)
+        AND (blogs.status = $4 OR $4 = '')
+        AND (%[1]s @@ search OR $5 = '')`
+
+// args returns the criteria bound to the $1 to $5 placeholders of
+// blogFilters.
+func (c BlogCriteria) args() []interface{} {
+	// A nil slice is bound as NULL, which doesn't match the empty array
+	// standing for any category.
+	category := c.Category
+	if category == nil {
+		category = []string{}
+	}
+
+	return []interface{}{c.Title, pq.Array(category), c.AuthorID, c.Status, c.Query}
+}
+
+// GetAll lists the blogs matching the criteria. When searching, each blog
+// gets a snippet of its body, and the blogs can be sorted by the "rank" of
+// their match.
+func (b BlogModel) GetAll(ctx context.Context, c BlogCriteria, f Filter) ([]*Blog, Metadata, error) {
+	if f.Keyset {
+		return b.getAllKeyset(ctx, c, f)
+	}
+
+	language := c.Language
+	if language == "" {
+		language = "simple"
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	sortColumn := "blogs." + f.sortColumn()
+	if f.sortColumn() == "rank" {
+		sortColumn = "rank"
+	}
+
+	query := fmt.Sprintf(blogListQuery, searchVector(language), language, "count(*) OVER()", "",
+		fmt.Sprintf("%s %s, blogs.id ASC", sortColumn, f.sortDirection()),
+		"LIMIT $6 OFFSET $7")
+
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(category), f.limit(), f.offset()}
+	args := append(c.args(), f.limit(), f.offset())
 
 	rows, err := b.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -150,25 +466,15 @@ func (b BlogModel) GetAll(title string, category []string, f Filter) ([]*Blog, M
 	}()
 
 	var totalRecords int
-	var blogs = make([]*Blog, 1)
+	blogs := []*Blog{}
 
 	for rows.Next() {
-		var blog Blog
-
-		err = rows.Scan(
-			&totalRecords,
-			&blog.ID,
-			&blog.CreatedAt,
-			&blog.Title,
-			&blog.Body,
-			pq.Array(&blog.Category),
-			&blog.Version)
-
+		blog, err := scanListedBlog(rows, &totalRecords)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
-		blogs = append(blogs, &blog)
+		blogs = append(blogs, blog)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -179,3 +485,201 @@ func (b BlogModel) GetAll(title string, category []string, f Filter) ([]*Blog, M
 
 	return blogs, metadata, nil
 }
+
+// getAllKeyset lists a page of the blogs matching the criteria after the
+// filter's cursor. One row more than the page size is read to find out if
+// another page follows.
+func (b BlogModel) getAllKeyset(ctx context.Context, c BlogCriteria, f Filter) ([]*Blog, Metadata, error) {
+	language := c.Language
+	if language == "" {
+		language = "simple"
+	}
+
+	cur, err := f.decodeCursor()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	args := append(c.args(), f.limit()+1)
+
+	where, orderBy := f.keyset(cur, "blogs."+f.sortColumn(), "blogs.id", len(args)+1)
+	if where != "" {
+		where = "AND " + where
+		args = append(args, cur.Key, cur.ID)
+	}
+
+	query := fmt.Sprintf(blogListQuery, searchVector(language), language, "0", where, orderBy, "LIMIT $6")
+
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var ignored int
+	blogs := []*Blog{}
+
+	for rows.Next() {
+		blog, err := scanListedBlog(rows, &ignored)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		blogs = append(blogs, blog)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	more := len(blogs) > f.limit()
+	if more {
+		blogs = blogs[:f.limit()]
+	}
+
+	if cur.Backward {
+		for i, j := 0, len(blogs)-1; i < j; i, j = i+1, j-1 {
+			blogs[i], blogs[j] = blogs[j], blogs[i]
+		}
+	}
+
+	var totalRecords int
+
+	if f.Count {
+		query := fmt.Sprintf(`SELECT count(*)
+			FROM blogs
+			CROSS JOIN websearch_to_tsquery('%[2]s', $5) AS search
+			WHERE `+blogFilters, searchVector(language), language)
+
+		err = b.DB.QueryRowContext(ctx, query, args[:5]...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	var first, last cursor
+	if len(blogs) > 0 {
+		first = blogCursor(blogs[0], f.sortColumn())
+		last = blogCursor(blogs[len(blogs)-1], f.sortColumn())
+	}
+
+	return blogs, f.keysetMetadata(cur, more, first, last, totalRecords), nil
+}
+
+// blogCursor returns the keyset position of a blog in a listing sorted by
+// the column.
+func blogCursor(blog *Blog, column string) cursor {
+	switch column {
+	case "id":
+		return cursor{Key: strconv.FormatInt(blog.ID, 10), ID: blog.ID}
+	case "title":
+		return cursor{Key: blog.Title, ID: blog.ID}
+	}
+
+	panic("unsupported keyset sort column: " + column)
+}
+
+// scanListedBlog scans a row of the blogListQuery.
+func scanListedBlog(rows *sql.Rows, totalRecords *int) (*Blog, error) {
+	var blog Blog
+	var publishAt sql.NullTime
+	var authorID sql.NullInt64
+	var authorName sql.NullString
+	var rank float64
+
+	err := rows.Scan(
+		totalRecords,
+		&blog.ID,
+		&blog.CreatedAt,
+		&blog.Title,
+		&blog.Slug,
+		&blog.Body,
+		pq.Array(&blog.Category),
+		&blog.Version,
+		&blog.Status,
+		&publishAt,
+		&authorID,
+		&authorName,
+		&rank,
+		&blog.Snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	blog.PublishAt = scanTime(publishAt)
+	blog.Author = scanAuthor(authorID, authorName)
+	blog.Snippet = snippetMarks.Replace(html.EscapeString(blog.Snippet))
+
+	return &blog, nil
+}
+
+// PublishScheduled publishes the scheduled blogs whose publish time has
+// come and returns how many were published. Like an update, publishing
+// archives the scheduled version in blog_revisions and bumps the version, in
+// one transaction.
+func (b BlogModel) PublishScheduled(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.Timeout)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE keeps the due blogs from being edited until they are
+	// published, so the archived revisions are the versions replaced.
+	query := `INSERT INTO blog_revisions (blog_id, version, title, body, category)
+		SELECT id, version, title, body, category FROM blogs
+		WHERE status = 'scheduled' AND publish_at <= NOW()
+		FOR UPDATE
+		RETURNING blog_id`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// Only the archived blogs are published, not ones scheduled by a
+	// transaction that committed in the meantime.
+	query = `UPDATE blogs
+		SET status = 'published', version = version + 1
+		WHERE id = ANY($1)`
+
+	res, err := tx.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
@@ -0,0 +1,31 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchVector(t *testing.T) {
+	for _, language := range SearchLanguages {
+		got := searchVector(language)
+
+		if language == "simple" {
+			if got != "blogs.search_vector" {
+				t.Errorf("simple -> want the stored vector; got: %q", got)
+			}
+			continue
+		}
+
+		if !strings.Contains(got, "'"+language+"'") {
+			t.Errorf("%s -> want the %q configuration; got: %q", language, language, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("want a panic for an unsafe language")
+		}
+	}()
+
+	searchVector("english', body) --")
+}
@@ -0,0 +1,343 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"github.com/lib/pq"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidParent is returned when a reply names a parent comment that
+// isn't an approved comment on the same blog.
+var ErrInvalidParent = errors.New("invalid parent comment")
+
+// Comment is a reader's response to a blog, or a reply to another comment
+// when ParentID is set.
+type Comment struct {
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	BlogID    int64      `json:"blog_id"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	Author    *Author    `json:"author,omitempty"`
+	Body      string     `json:"body"`
+	Status    string     `json:"-"`
+	Flags     []string   `json:"-"`
+	IP        string     `json:"-"`
+	Version   int32      `json:"version,omitempty"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+// IsAuthor returns true if the user with the given id wrote the comment.
+func (c *Comment) IsAuthor(userID int64) bool {
+	return c.Author != nil && c.Author.ID == userID
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(utf8.RuneCountInString(comment.Body) <= 5000, "body", "must not be more than 5000 characters long")
+
+	if comment.ParentID != nil {
+		v.Check(*comment.ParentID > 0, "parent_id", "must be greater than zero")
+	}
+}
+
+type CommentModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert stores a new comment. A reply is only stored when its parent is an
+// approved comment on the same blog, otherwise ErrInvalidParent is returned.
+func (cm CommentModel) Insert(ctx context.Context, comment *Comment) error {
+	query := `INSERT INTO comments (blog_id, parent_id, author_id, body, status, flags, ip)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE $2::bigint IS NULL
+			OR EXISTS (SELECT 1 FROM comments WHERE id = $2 AND blog_id = $1 AND status = 'approved')
+		RETURNING id, created_at, version`
+
+	var authorID *int64
+	if comment.Author != nil {
+		authorID = &comment.Author.ID
+	}
+
+	args := []interface{}{
+		comment.BlogID,
+		comment.ParentID,
+		authorID,
+		comment.Body,
+		comment.Status,
+		pq.Array(comment.Flags),
+		comment.IP,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	err := cm.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidParent
+		}
+		return constraintError(err)
+	}
+
+	return nil
+}
+
+func (cm CommentModel) Get(ctx context.Context, id int64) (*Comment, error) {
+	query := `SELECT comments.id, comments.created_at, comments.blog_id, comments.parent_id,
+		comments.body, comments.status, comments.flags, comments.version, users.id, users.name
+		FROM comments
+		LEFT JOIN users ON users.id = comments.author_id
+		WHERE comments.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	var comment Comment
+	var parentID, authorID sql.NullInt64
+	var authorName sql.NullString
+
+	err := cm.DB.QueryRowContext(ctx, query, id).Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.BlogID,
+		&parentID,
+		&comment.Body,
+		&comment.Status,
+		pq.Array(&comment.Flags),
+		&comment.Version,
+		&authorID,
+		&authorName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	comment.ParentID = scanID(parentID)
+	comment.Author = scanAuthor(authorID, authorName)
+
+	return &comment, nil
+}
+
+// Delete removes a comment together with all the replies below it.
+func (cm CommentModel) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM comments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	result, err := cm.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns a page of the approved top-level comments of a blog, each
+// with its approved replies nested below it down to the given depth. A depth
+// of 1 returns only the top-level comments. The filter pages and sorts the
+// top-level comments; replies are always ordered oldest first.
+func (cm CommentModel) GetAll(ctx context.Context, blogID int64, depth int, f Filter) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`WITH RECURSIVE roots AS (
+			SELECT count(*) OVER() AS total, id,
+				row_number() OVER (ORDER BY %[1]s %[2]s, id ASC) AS position
+			FROM comments
+			WHERE blog_id = $1 AND parent_id IS NULL AND status = 'approved'
+			ORDER BY %[1]s %[2]s, id ASC
+			LIMIT $2 OFFSET $3
+		), thread AS (
+			SELECT id, position, 1 AS depth FROM roots
+			UNION ALL
+			SELECT comments.id, thread.position, thread.depth + 1
+			FROM comments
+			INNER JOIN thread ON comments.parent_id = thread.id
+			WHERE thread.depth < $4 AND comments.status = 'approved'
+		)
+		SELECT (SELECT total FROM roots LIMIT 1), comments.id, comments.created_at,
+			comments.parent_id, comments.body, comments.status, comments.flags, comments.version,
+			users.id, users.name
+		FROM thread
+		INNER JOIN comments ON comments.id = thread.id
+		LEFT JOIN users ON users.id = comments.author_id
+		ORDER BY thread.depth, thread.position, comments.created_at, comments.id`,
+		f.sortColumn(), f.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, query, blogID, f.limit(), f.offset(), depth)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	comments := []*Comment{}
+	byID := make(map[int64]*Comment)
+
+	for rows.Next() {
+		comment := Comment{BlogID: blogID}
+		var parentID, authorID sql.NullInt64
+		var authorName sql.NullString
+
+		err = rows.Scan(
+			&totalRecords,
+			&comment.ID,
+			&comment.CreatedAt,
+			&parentID,
+			&comment.Body,
+			&comment.Status,
+			pq.Array(&comment.Flags),
+			&comment.Version,
+			&authorID,
+			&authorName)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		comment.ParentID = scanID(parentID)
+		comment.Author = scanAuthor(authorID, authorName)
+
+		byID[comment.ID] = &comment
+
+		// Rows come ordered by depth, so a reply's parent is always seen
+		// before the reply itself.
+		if comment.ParentID == nil {
+			comments = append(comments, &comment)
+		} else if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, &comment)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, f.Page, f.PageSize)
+
+	return comments, metadata, nil
+}
+
+// GetAllByStatus returns a page of the comments in a moderation state across
+// all blogs, without nesting the replies.
+func (cm CommentModel) GetAllByStatus(ctx context.Context, status string, f Filter) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), comments.id, comments.created_at, comments.blog_id,
+		comments.parent_id, comments.body, comments.status, comments.flags, comments.version,
+		users.id, users.name
+		FROM comments
+		LEFT JOIN users ON users.id = comments.author_id
+		WHERE comments.status = $1
+		ORDER BY comments.%s %s, comments.id ASC
+		LIMIT $2 OFFSET $3`, f.sortColumn(), f.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, query, status, f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	comments := []*Comment{}
+
+	for rows.Next() {
+		var comment Comment
+		var parentID, authorID sql.NullInt64
+		var authorName sql.NullString
+
+		err = rows.Scan(
+			&totalRecords,
+			&comment.ID,
+			&comment.CreatedAt,
+			&comment.BlogID,
+			&parentID,
+			&comment.Body,
+			&comment.Status,
+			pq.Array(&comment.Flags),
+			&comment.Version,
+			&authorID,
+			&authorName)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		comment.ParentID = scanID(parentID)
+		comment.Author = scanAuthor(authorID, authorName)
+
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, f.Page, f.PageSize)
+
+	return comments, metadata, nil
+}
+
+// SetStatus moves the comments with the given ids to a moderation state and
+// returns how many of them exist.
+func (cm CommentModel) SetStatus(ctx context.Context, status string, ids ...int64) (int64, error) {
+	query := `UPDATE comments
+		SET status = $1, version = version + 1
+		WHERE id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	result, err := cm.DB.ExecContext(ctx, query, status, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// CommenterHistory counts the approved comments of a user, and the comments
+// posted from an IP address since the given time.
+func (cm CommentModel) CommenterHistory(ctx context.Context, authorID int64, ip string, since time.Time) (CommenterHistory, error) {
+	query := `SELECT
+		(SELECT count(*) FROM comments WHERE author_id = $1 AND status = 'approved'),
+		(SELECT count(*) FROM comments WHERE ip = $2 AND created_at >= $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, cm.Timeout)
+	defer cancel()
+
+	var history CommenterHistory
+
+	err := cm.DB.QueryRowContext(ctx, query, authorID, ip, since).Scan(
+		&history.ApprovedComments,
+		&history.RecentFromIP)
+	if err != nil {
+		return CommenterHistory{}, err
+	}
+
+	return history, nil
+}
+
+func scanID(id sql.NullInt64) *int64 {
+	if !id.Valid {
+		return nil
+	}
+	return &id.Int64
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// fieldError is the validation error a database constraint stands for.
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+// constraintFields maps the names of the database constraints guarding user
+// input to the validation errors reported when they are violated. Each of
+// them is also enforced by a validation rule in Go, which should catch the
+// input first.
+var constraintFields = map[string]fieldError{
+	"title_length_check":         {"title", "must be between 3 and 70 characters long"},
+	"category_length_check":      {"category", "must contain between 1 and 5 categories"},
+	"status_check":               {"status", "invalid status value"},
+	"publish_at_check":           {"publish_at", "must be provided for scheduled blogs"},
+	"comments_body_length_check": {"body", "must be between 1 and 5000 characters long"},
+	"comments_status_check":      {"status", "invalid status value"},
+}
+
+// ConstraintError is returned when a write violates a database constraint
+// that stands for a validation rule, which means the rule in Go let through
+// input the database refuses.
+type ConstraintError struct {
+	Constraint string
+	Field      string
+	Message    string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("constraint %s violated: %s", e.Constraint, e.Err)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Errors returns the violation in the form of validator.Validator errors.
+func (e *ConstraintError) Errors() map[string]string {
+	return map[string]string{e.Field: e.Message}
+}
+
+// constraintError turns a PostgreSQL integrity constraint violation of one
+// of the constraintFields into a ConstraintError. Other errors are returned
+// unchanged.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+
+	if !errors.As(err, &pqErr) || pqErr.Code.Class() != "23" {
+		return err
+	}
+
+	field, ok := constraintFields[pqErr.Constraint]
+	if !ok {
+		return err
+	}
+
+	return &ConstraintError{
+		Constraint: pqErr.Constraint,
+		Field:      field.Field,
+		Message:    field.Message,
+		Err:        err,
+	}
+}
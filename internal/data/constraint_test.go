@@ -0,0 +1,225 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"github.com/lib/pq"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	checkRX   = regexp.MustCompile(`(?s)ADD CONSTRAINT (\w+) CHECK\s*\((.*?)\);`)
+	betweenRX = regexp.MustCompile(`^(?:char|array)_length\(\w+(?:, 1)?\) BETWEEN (\d+) AND (\d+)$`)
+	inRX      = regexp.MustCompile(`^\w+ IN \((.*)\)$`)
+)
+
+// checkConstraints returns the CHECK constraints the up migrations leave in
+// the schema, by name.
+func checkConstraints(t *testing.T) map[string]string {
+	files, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(files)
+
+	checks := make(map[string]string)
+
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range checkRX.FindAllStringSubmatch(string(sql), -1) {
+			checks[m[1]] = strings.Join(strings.Fields(m[2]), " ")
+		}
+	}
+
+	if len(checks) == 0 {
+		t.Fatal("no CHECK constraints found in the migrations")
+	}
+
+	return checks
+}
+
+func validBlog() *Blog {
+	return &Blog{
+		Title:    "gRPC in Go!",
+		Body:     "I do not know yet",
+		Category: []string{"Golang", "Network"},
+		Status:   StatusPublished,
+	}
+}
+
+func blogValid(field string, modify func(blog *Blog)) bool {
+	blog := validBlog()
+	modify(blog)
+
+	v := validator.New()
+	ValidateBlog(v, blog)
+
+	return v.Errors[field] == ""
+}
+
+func commentValid(field string, modify func(comment *Comment)) bool {
+	comment := &Comment{Body: "Nice post!"}
+	modify(comment)
+
+	v := validator.New()
+	ValidateComment(v, comment)
+
+	return v.Errors[field] == ""
+}
+
+// lengthRules report whether the Go validation accepts a value of length n
+// for the field guarded by a length CHECK constraint. Multi-byte characters
+// are used, as the database counts characters.
+var lengthRules = map[string]func(n int) bool{
+	"title_length_check": func(n int) bool {
+		return blogValid("title", func(blog *Blog) { blog.Title = strings.Repeat("ğ", n) })
+	},
+	"category_length_check": func(n int) bool {
+		return blogValid("category", func(blog *Blog) {
+			blog.Category = make([]string, n)
+			for i := range blog.Category {
+				blog.Category[i] = "category-" + strconv.Itoa(i)
+			}
+		})
+	},
+	"comments_body_length_check": func(n int) bool {
+		return commentValid("body", func(comment *Comment) { comment.Body = strings.Repeat("ğ", n) })
+	},
+}
+
+// listRules are the values the Go validation accepts for the field guarded
+// by an IN CHECK constraint.
+var listRules = map[string][]string{
+	"status_check":          BlogStatuses,
+	"comments_status_check": CommentStatuses,
+}
+
+// TestConstraintsMatchValidation makes sure every CHECK constraint of the
+// schema is mapped to a field error, and that the Go validation rules accept
+// exactly what the constraints accept.
+func TestConstraintsMatchValidation(t *testing.T) {
+	checks := checkConstraints(t)
+
+	for name := range constraintFields {
+		if _, ok := checks[name]; !ok {
+			t.Errorf("%s is mapped but isn't a constraint in the migrations", name)
+		}
+	}
+
+	for name, check := range checks {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := constraintFields[name]; !ok {
+				t.Fatalf("no field error for the constraint: %s", check)
+			}
+
+			switch {
+			case betweenRX.MatchString(check):
+				m := betweenRX.FindStringSubmatch(check)
+				min, _ := strconv.Atoi(m[1])
+				max, _ := strconv.Atoi(m[2])
+
+				rule, ok := lengthRules[name]
+				if !ok {
+					t.Fatalf("no Go rule to compare with: %s", check)
+				}
+
+				for n, want := range map[int]bool{min - 1: false, min: true, max: true, max + 1: false} {
+					if got := rule(n); got != want {
+						t.Errorf("length %d -> want valid: %t; got: %t (%s)", n, want, got, check)
+					}
+				}
+
+			case inRX.MatchString(check):
+				var values []string
+				for _, v := range strings.Split(inRX.FindStringSubmatch(check)[1], ",") {
+					values = append(values, strings.Trim(strings.TrimSpace(v), "'"))
+				}
+
+				want, ok := listRules[name]
+				if !ok {
+					t.Fatalf("no Go rule to compare with: %s", check)
+				}
+
+				if !reflect.DeepEqual(values, want) {
+					t.Errorf("want: %q; got: %q (%s)", want, values, check)
+				}
+
+			case name == "publish_at_check":
+				publishAt := time.Now()
+
+				scheduled := func(publishAt *time.Time) func(blog *Blog) {
+					return func(blog *Blog) {
+						blog.Status = StatusScheduled
+						blog.PublishAt = publishAt
+					}
+				}
+
+				if blogValid("publish_at", scheduled(nil)) {
+					t.Error("want scheduled blogs without publish_at to be invalid")
+				}
+
+				if !blogValid("publish_at", scheduled(&publishAt)) {
+					t.Error("want scheduled blogs with publish_at to be valid")
+				}
+
+			default:
+				t.Fatalf("don't know how to compare the constraint: %s", check)
+			}
+		})
+	}
+}
+
+func TestConstraintError(t *testing.T) {
+	violation := &pq.Error{Code: "23514", Constraint: "title_length_check"}
+
+	tests := []struct {
+		name string
+		err  error
+		want map[string]string
+	}{
+		{name: "Known Constraint", err: fmt.Errorf("insert: %w", violation),
+			want: map[string]string{"title": "must be between 3 and 70 characters long"}},
+		{name: "Unknown Constraint", err: &pq.Error{Code: "23514", Constraint: "other_check"}},
+		{name: "Not A Violation", err: &pq.Error{Code: "57014", Constraint: "title_length_check"}},
+		{name: "Not A Database Error", err: ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := constraintError(tt.err)
+
+			var constraintErr *ConstraintError
+			if !errors.As(err, &constraintErr) {
+				if tt.want != nil {
+					t.Fatalf("want a ConstraintError; got: %v", err)
+				}
+				if err != tt.err {
+					t.Errorf("want the error unchanged; got: %v", err)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(constraintErr.Errors(), tt.want) {
+				t.Errorf("want: %v; got: %v", tt.want, constraintErr.Errors())
+			}
+
+			if !errors.Is(err, violation) {
+				t.Errorf("want the database error wrapped; got: %v", err)
+			}
+		})
+	}
+}
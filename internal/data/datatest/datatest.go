@@ -0,0 +1,1008 @@
+// Package datatest is a conformance suite for the implementations of
+// data.Model, which makes sure they all behave like the PostgreSQL models the
+// handlers are written against.
+package datatest
+
+import (
+	"context"
+	"errors"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run runs the suite against the models returned by newModel. It is called
+// once for every test, which run one after the other, and must return models
+// without any records.
+func Run(t *testing.T, newModel func(t *testing.T) data.Model) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, m data.Model)
+	}{
+		{name: "Blog CRUD", test: testBlogCRUD},
+		{name: "Blog Update", test: testBlogUpdate},
+		{name: "Blog Slugs", test: testBlogSlugs},
+		{name: "Blog Constraints", test: testBlogConstraints},
+		{name: "Blog Filters", test: testBlogFilters},
+		{name: "Blog Sorting", test: testBlogSorting},
+		{name: "Blog Pagination", test: testBlogPagination},
+		{name: "Blog Keyset Pagination", test: testBlogKeyset},
+		{name: "Blog Search", test: testBlogSearch},
+		{name: "Publish Scheduled", test: testPublishScheduled},
+		{name: "Comments", test: testComments},
+		{name: "Comment Moderation", test: testCommentModeration},
+		{name: "Users", test: testUsers},
+		{name: "Register", test: testRegister},
+		{name: "Tokens", test: testTokens},
+		{name: "Permissions", test: testPermissions},
+		{name: "Cancelled Context", test: testCancelledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newModel(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+const password = "pa55word1234"
+
+func newUser(t *testing.T, m data.Model, name string) *data.User {
+	t.Helper()
+
+	user := &data.User{Name: name, Email: strings.ToLower(name) + "@example.com", Activated: true}
+
+	err := user.Password.Set(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.User.Insert(ctx, user)
+	if err != nil {
+		t.Fatalf("insert user %s: %v", name, err)
+	}
+
+	return user
+}
+
+// newBlog inserts a published blog in a "General" category, changed by the
+// modify functions first.
+func newBlog(t *testing.T, m data.Model, title string, modify ...func(blog *data.Blog)) *data.Blog {
+	t.Helper()
+
+	blog := &data.Blog{
+		Title:    title,
+		Body:     "The body of " + title,
+		Category: []string{"General"},
+		Status:   data.StatusPublished,
+	}
+
+	for _, f := range modify {
+		f(blog)
+	}
+
+	err := m.Blog.Insert(ctx, blog)
+	if err != nil {
+		t.Fatalf("insert blog %q: %v", title, err)
+	}
+
+	return blog
+}
+
+func newComment(t *testing.T, m data.Model, comment *data.Comment) *data.Comment {
+	t.Helper()
+
+	if comment.Flags == nil {
+		comment.Flags = []string{}
+	}
+
+	err := m.Comment.Insert(ctx, comment)
+	if err != nil {
+		t.Fatalf("insert comment %q: %v", comment.Body, err)
+	}
+
+	return comment
+}
+
+func blogIDs(t *testing.T, blogs []*data.Blog) []int64 {
+	t.Helper()
+
+	if blogs == nil {
+		t.Error("want an empty list of blogs; got: nil")
+	}
+
+	ids := []int64{}
+	for i, blog := range blogs {
+		if blog == nil {
+			t.Fatalf("blog %d of the listing is nil", i)
+		}
+		ids = append(ids, blog.ID)
+	}
+
+	return ids
+}
+
+func wantErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Errorf("%s -> want: %v; got: %v", what, want, err)
+	}
+}
+
+func wantConstraintError(t *testing.T, what string, err error, field string) {
+	t.Helper()
+
+	var constraintErr *data.ConstraintError
+	if !errors.As(err, &constraintErr) {
+		t.Errorf("%s -> want a ConstraintError; got: %v", what, err)
+		return
+	}
+
+	if constraintErr.Field != field {
+		t.Errorf("%s -> want field: %s; got: %s", what, field, constraintErr.Field)
+	}
+}
+
+func testBlogCRUD(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+
+	blog := newBlog(t, m, "Alpha Post", func(blog *data.Blog) {
+		blog.Author = &data.Author{ID: ada.ID}
+		blog.Category = []string{"Go", "Databases"}
+	})
+
+	if blog.ID < 1 || blog.Version != 1 || blog.Slug != "alpha-post" || blog.CreatedAt.IsZero() {
+		t.Errorf("Insert -> want id, version 1, slug and creation time; got: %+v", blog)
+	}
+
+	got, err := m.Blog.Get(ctx, blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := *blog
+	want.Author = &data.Author{ID: ada.ID, Name: "Ada"}
+	want.CreatedAt = got.CreatedAt
+
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("Get -> want: %+v; got: %+v", &want, got)
+	}
+
+	if !got.CreatedAt.Equal(blog.CreatedAt) {
+		t.Errorf("CreatedAt -> want: %v; got: %v", blog.CreatedAt, got.CreatedAt)
+	}
+
+	bySlug, err := m.Blog.GetBySlug(ctx, "alpha-post")
+	if err != nil || bySlug.ID != blog.ID {
+		t.Errorf("GetBySlug -> want blog %d; got: %+v, %v", blog.ID, bySlug, err)
+	}
+
+	anonymous := newBlog(t, m, "Bravo Post")
+
+	got, err = m.Blog.Get(ctx, anonymous.ID)
+	if err != nil || got.Author != nil {
+		t.Errorf("Get -> want a blog without author; got: %+v, %v", got, err)
+	}
+
+	_, err = m.Blog.Get(ctx, anonymous.ID+1000)
+	wantErr(t, "Get missing", err, data.ErrRecordNotFound)
+
+	_, err = m.Blog.GetBySlug(ctx, "missing-post")
+	wantErr(t, "GetBySlug missing", err, data.ErrRecordNotFound)
+
+	err = m.Blog.Delete(ctx, blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Blog.Get(ctx, blog.ID)
+	wantErr(t, "Get deleted", err, data.ErrRecordNotFound)
+
+	_, err = m.Blog.GetBySlug(ctx, "alpha-post")
+	wantErr(t, "GetBySlug deleted", err, data.ErrRecordNotFound)
+
+	err = m.Blog.Delete(ctx, blog.ID)
+	wantErr(t, "Delete deleted", err, data.ErrRecordNotFound)
+}
+
+func testBlogUpdate(t *testing.T, m data.Model) {
+	blog := newBlog(t, m, "Alpha Post")
+	stale := *blog
+
+	blog.Title = "Bravo Post"
+	blog.Body = "A new body"
+	blog.Category = []string{"Go"}
+
+	err := m.Blog.Update(ctx, blog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blog.Version != 2 || blog.Slug != "bravo-post" {
+		t.Errorf("Update -> want version 2 and slug bravo-post; got: %d and %s", blog.Version, blog.Slug)
+	}
+
+	stale.Body = "A conflicting body"
+	err = m.Blog.Update(ctx, &stale)
+	wantErr(t, "Update stale version", err, data.ErrEditConflict)
+
+	missing := *blog
+	missing.ID += 1000
+	err = m.Blog.Update(ctx, &missing)
+	wantErr(t, "Update missing", err, data.ErrEditConflict)
+
+	got, err := m.Blog.Get(ctx, blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Version != 2 || got.Body != "A new body" || !reflect.DeepEqual(got.Category, []string{"Go"}) {
+		t.Errorf("Get -> want the first update only; got: %+v", got)
+	}
+
+	old, err := m.Blog.GetBySlug(ctx, "alpha-post")
+	if err != nil || old.ID != blog.ID || old.Slug != "bravo-post" {
+		t.Errorf("GetBySlug old slug -> want blog %d with slug bravo-post; got: %+v, %v", blog.ID, old, err)
+	}
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "-version", SortSafeList: []string{"version", "-version"}}
+
+	revisions, metadata, err := m.Revision.GetAll(ctx, blog.ID, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revisions) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("Revisions -> want the current version and version 1; got: %+v, %+v", revisions, metadata)
+	}
+
+	if revisions[0].Version != 2 || revisions[0].Body != "A new body" || revisions[0].ReplacedAt != nil {
+		t.Errorf("Revisions -> want the current version first; got: %+v", revisions[0])
+	}
+
+	if revisions[1].Version != 1 || revisions[1].Title != "Alpha Post" || revisions[1].ReplacedAt == nil ||
+		!reflect.DeepEqual(revisions[1].Category, []string{"General"}) {
+		t.Errorf("Revisions -> want version 1 archived; got: %+v", revisions[1])
+	}
+
+	f.Sort, f.PageSize = "version", 1
+
+	revisions, metadata, err = m.Revision.GetAll(ctx, blog.ID, f)
+	if err != nil || len(revisions) != 1 || revisions[0].Version != 1 || metadata.LastPage != 2 {
+		t.Errorf("Revisions page -> want version 1 of 2 pages; got: %+v, %+v, %v", revisions, metadata, err)
+	}
+
+	revision, err := m.Revision.Get(ctx, blog.ID, 1)
+	if err != nil || revision.Body != "The body of Alpha Post" {
+		t.Errorf("Revision -> want version 1; got: %+v, %v", revision, err)
+	}
+
+	_, err = m.Revision.Get(ctx, blog.ID, 2)
+	wantErr(t, "Revision of the current version", err, data.ErrRecordNotFound)
+
+	revisions, _, err = m.Revision.GetAll(ctx, missing.ID, f)
+	if err != nil || revisions == nil || len(revisions) != 0 {
+		t.Errorf("Revisions of a missing blog -> want an empty list; got: %v, %v", revisions, err)
+	}
+}
+
+func testBlogSlugs(t *testing.T, m data.Model) {
+	first := newBlog(t, m, "Alpha Post")
+	second := newBlog(t, m, "Alpha Post")
+	third := newBlog(t, m, "Alpha: Post!")
+
+	for blog, want := range map[*data.Blog]string{first: "alpha-post", second: "alpha-post-2", third: "alpha-post-3"} {
+		if blog.Slug != want {
+			t.Errorf("Slug -> want: %s; got: %s", want, blog.Slug)
+		}
+	}
+
+	// A title keeping the same slug base keeps the slug.
+	second.Title = "Alpha post"
+	err := m.Blog.Update(ctx, second)
+	if err != nil || second.Slug != "alpha-post-2" {
+		t.Errorf("Update -> want slug alpha-post-2; got: %s, %v", second.Slug, err)
+	}
+}
+
+func testBlogConstraints(t *testing.T, m data.Model) {
+	err := m.Blog.Insert(ctx, &data.Blog{Title: "Go", Body: "Short title", Category: []string{"Go"},
+		Status: data.StatusPublished})
+	wantConstraintError(t, "Insert short title", err, "title")
+
+	err = m.Blog.Insert(ctx, &data.Blog{Title: "Alpha Post", Body: "Scheduled", Category: []string{"Go"},
+		Status: data.StatusScheduled})
+	wantConstraintError(t, "Insert scheduled without publish_at", err, "publish_at")
+
+	blog := newBlog(t, m, "Alpha Post")
+
+	update := *blog
+	update.Category = []string{"a", "b", "c", "d", "e", "f"}
+	err = m.Blog.Update(ctx, &update)
+	wantConstraintError(t, "Update too many categories", err, "category")
+
+	update = *blog
+	update.Status = "deleted"
+	err = m.Blog.Update(ctx, &update)
+	wantConstraintError(t, "Update invalid status", err, "status")
+
+	got, err := m.Blog.Get(ctx, blog.ID)
+	if err != nil || got.Version != 1 {
+		t.Errorf("Get -> want the blog unchanged; got: %+v, %v", got, err)
+	}
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "version", SortSafeList: []string{"version"}}
+
+	revisions, _, err := m.Revision.GetAll(ctx, blog.ID, f)
+	if err != nil || len(revisions) != 1 || revisions[0].ReplacedAt != nil {
+		t.Errorf("Revisions -> want only the current version after failed updates; got: %+v, %v", revisions, err)
+	}
+}
+
+func testBlogFilters(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+	byAda := func(blog *data.Blog) { blog.Author = &data.Author{ID: ada.ID} }
+
+	category := func(category ...string) func(blog *data.Blog) {
+		return func(blog *data.Blog) { blog.Category = category }
+	}
+
+	channels := newBlog(t, m, "Alpha Go Channels", byAda, category("Go", "Concurrency"))
+	traits := newBlog(t, m, "Bravo Rust Traits", byAda, category("Rust"), func(blog *data.Blog) {
+		blog.Status = data.StatusDraft
+	})
+	generics := newBlog(t, m, "Charlie Go Generics", category("Go"))
+	comptime := newBlog(t, m, "Delta Zig Comptime", category("Zig", "Go"))
+
+	all := []int64{channels.ID, traits.ID, generics.ID, comptime.ID}
+
+	tests := []struct {
+		name     string
+		criteria data.BlogCriteria
+		want     []int64
+	}{
+		{name: "No Criteria", want: all},
+		{name: "Empty Category", criteria: data.BlogCriteria{Category: []string{}}, want: all},
+		{name: "Title Word", criteria: data.BlogCriteria{Title: "go"},
+			want: []int64{channels.ID, generics.ID}},
+		{name: "Title Words In Any Order", criteria: data.BlogCriteria{Title: "GENERICS go"},
+			want: []int64{generics.ID}},
+		{name: "Title Without Match", criteria: data.BlogCriteria{Title: "java"}, want: []int64{}},
+		{name: "Category", criteria: data.BlogCriteria{Category: []string{"Go"}},
+			want: []int64{channels.ID, generics.ID, comptime.ID}},
+		{name: "All Categories", criteria: data.BlogCriteria{Category: []string{"Concurrency", "Go"}},
+			want: []int64{channels.ID}},
+		{name: "Category Is Case Sensitive", criteria: data.BlogCriteria{Category: []string{"go"}},
+			want: []int64{}},
+		{name: "Author", criteria: data.BlogCriteria{AuthorID: ada.ID},
+			want: []int64{channels.ID, traits.ID}},
+		{name: "Status", criteria: data.BlogCriteria{Status: data.StatusDraft},
+			want: []int64{traits.ID}},
+		{name: "Combined", criteria: data.BlogCriteria{Title: "go", Category: []string{"Go"},
+			AuthorID: ada.ID, Status: data.StatusPublished}, want: []int64{channels.ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := data.Filter{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+			blogs, _, err := m.Blog.GetAll(ctx, tt.criteria, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := blogIDs(t, blogs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %v; got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func testBlogSorting(t *testing.T, m data.Model) {
+	charlie := newBlog(t, m, "Charlie Post")
+	alpha := newBlog(t, m, "Alpha Post")
+	bravo := newBlog(t, m, "Bravo Post")
+	alphaAgain := newBlog(t, m, "Alpha Post")
+
+	// Ties are broken by ascending id, whatever the direction.
+	tests := []struct {
+		sort string
+		want []int64
+	}{
+		{sort: "id", want: []int64{charlie.ID, alpha.ID, bravo.ID, alphaAgain.ID}},
+		{sort: "-id", want: []int64{alphaAgain.ID, bravo.ID, alpha.ID, charlie.ID}},
+		{sort: "title", want: []int64{alpha.ID, alphaAgain.ID, bravo.ID, charlie.ID}},
+		{sort: "-title", want: []int64{charlie.ID, bravo.ID, alpha.ID, alphaAgain.ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			f := data.Filter{Page: 1, PageSize: 10, Sort: tt.sort,
+				SortSafeList: []string{"id", "title", "-id", "-title"}}
+
+			blogs, _, err := m.Blog.GetAll(ctx, data.BlogCriteria{}, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := blogIDs(t, blogs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %v; got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func testBlogPagination(t *testing.T, m data.Model) {
+	var ids []int64
+	for _, title := range []string{"Alpha Post", "Bravo Post", "Charlie Post", "Delta Post", "Echo Post"} {
+		ids = append(ids, newBlog(t, m, title).ID)
+	}
+
+	tests := []struct {
+		name     string
+		criteria data.BlogCriteria
+		page     int
+		want     []int64
+		metadata data.Metadata
+	}{
+		{name: "First Page", page: 1, want: ids[0:2],
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 2, FirstPage: 1, LastPage: 3, TotalRecords: 5}},
+		{name: "Last Page", page: 3, want: ids[4:5],
+			metadata: data.Metadata{CurrentPage: 3, PageSize: 2, FirstPage: 1, LastPage: 3, TotalRecords: 5}},
+		{name: "Past The Last Page", page: 4, want: []int64{}},
+		{name: "No Match", criteria: data.BlogCriteria{Title: "missing"}, page: 1, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := data.Filter{Page: tt.page, PageSize: 2, Sort: "id", SortSafeList: []string{"id"}}
+
+			blogs, metadata, err := m.Blog.GetAll(ctx, tt.criteria, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := blogIDs(t, blogs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Blogs -> want: %v; got: %v", tt.want, got)
+			}
+
+			if !reflect.DeepEqual(metadata, tt.metadata) {
+				t.Errorf("Metadata -> want: %+v; got: %+v", tt.metadata, metadata)
+			}
+		})
+	}
+}
+
+func testBlogKeyset(t *testing.T, m data.Model) {
+	echo := newBlog(t, m, "Echo Post")
+	alpha := newBlog(t, m, "Alpha Post")
+	delta := newBlog(t, m, "Delta Post")
+	bravo := newBlog(t, m, "Bravo Post")
+	alphaAgain := newBlog(t, m, "Alpha Post")
+
+	// Keyset pages order the ties by id in the direction of the sort.
+	tests := []struct {
+		sort string
+		want []int64
+	}{
+		{sort: "title", want: []int64{alpha.ID, alphaAgain.ID, bravo.ID, delta.ID, echo.ID}},
+		{sort: "-title", want: []int64{echo.ID, delta.ID, bravo.ID, alphaAgain.ID, alpha.ID}},
+		{sort: "-id", want: []int64{alphaAgain.ID, bravo.ID, delta.ID, alpha.ID, echo.ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			f := data.Filter{Page: 1, PageSize: 2, Sort: tt.sort,
+				SortSafeList: []string{"id", "title", "-id", "-title"},
+				Keyset:       true, CursorKey: []byte("secret"), Count: true}
+
+			// Walk forward to the last page, then back to the first one.
+			var forward, backward []int64
+			var lastPage string
+
+			for i := 0; i < 5; i++ {
+				blogs, metadata, err := m.Blog.GetAll(ctx, data.BlogCriteria{}, f)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if metadata.TotalRecords != 5 {
+					t.Errorf("Total -> want: 5; got: %d", metadata.TotalRecords)
+				}
+
+				if (f.Cursor == "") != (metadata.PrevCursor == "") {
+					t.Errorf("Prev Cursor -> want one on every page but the first; got: %q", metadata.PrevCursor)
+				}
+
+				forward = append(forward, blogIDs(t, blogs)...)
+
+				if metadata.NextCursor == "" {
+					lastPage = f.Cursor
+					break
+				}
+				f.Cursor = metadata.NextCursor
+			}
+
+			if !reflect.DeepEqual(forward, tt.want) {
+				t.Fatalf("Forward -> want: %v; got: %v", tt.want, forward)
+			}
+
+			f.Cursor = lastPage
+
+			for i := 0; i < 5; i++ {
+				blogs, metadata, err := m.Blog.GetAll(ctx, data.BlogCriteria{}, f)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				backward = append(blogIDs(t, blogs), backward...)
+
+				if metadata.PrevCursor == "" {
+					break
+				}
+				f.Cursor = metadata.PrevCursor
+			}
+
+			if !reflect.DeepEqual(backward, tt.want) {
+				t.Errorf("Backward -> want: %v; got: %v", tt.want, backward)
+			}
+
+			f.Cursor = lastPage + "x"
+
+			_, _, err := m.Blog.GetAll(ctx, data.BlogCriteria{}, f)
+			wantErr(t, "Tampered cursor", err, data.ErrInvalidCursor)
+		})
+	}
+}
+
+func testBlogSearch(t *testing.T, m data.Model) {
+	tips := newBlog(t, m, "Alpha Postgres Tips", func(blog *data.Blog) {
+		blog.Body = "Run vacuum often."
+	})
+	notes := newBlog(t, m, "Bravo Notes", func(blog *data.Blog) {
+		blog.Body = "We moved to postgres last year."
+	})
+	mysql := newBlog(t, m, "Charlie Mysql", func(blog *data.Blog) {
+		blog.Body = "Nothing to say."
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		sort  string
+		want  []int64
+	}{
+		{name: "Title Ranks First", query: "postgres", sort: "-rank", want: []int64{tips.ID, notes.ID}},
+		{name: "Sorted By ID", query: "postgres", sort: "-id", want: []int64{notes.ID, tips.ID}},
+		{name: "Excluded Word", query: "postgres -vacuum", sort: "-rank", want: []int64{notes.ID}},
+		{name: "Alternatives", query: "mysql or vacuum", sort: "id", want: []int64{tips.ID, mysql.ID}},
+		{name: "No Match", query: "oracle", sort: "-rank", want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := data.Filter{Page: 1, PageSize: 10, Sort: tt.sort, SortSafeList: []string{"id", "-id", "-rank"}}
+
+			blogs, _, err := m.Blog.GetAll(ctx, data.BlogCriteria{Query: tt.query}, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := blogIDs(t, blogs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %v; got: %v", tt.want, got)
+			}
+
+			for _, blog := range blogs {
+				if blog.ID == notes.ID && !strings.Contains(blog.Snippet, "<mark>postgres</mark>") {
+					t.Errorf("Snippet -> want the match highlighted; got: %q", blog.Snippet)
+				}
+			}
+		})
+	}
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+	markup := newBlog(t, m, "Delta Kafka", func(blog *data.Blog) {
+		blog.Body = "<script>alert(1)</script> kafka queues"
+	})
+
+	blogs, _, err := m.Blog.GetAll(ctx, data.BlogCriteria{Query: "kafka"}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := blogIDs(t, blogs); !reflect.DeepEqual(got, []int64{markup.ID}) {
+		t.Fatalf("Escaped -> want: %v; got: %v", []int64{markup.ID}, got)
+	}
+
+	if snippet := blogs[0].Snippet; strings.Contains(snippet, "<script>") ||
+		!strings.Contains(snippet, "<mark>kafka</mark>") {
+		t.Errorf("Snippet -> want the body escaped and the match highlighted; got: %q", snippet)
+	}
+
+	blogs, _, err = m.Blog.GetAll(ctx, data.BlogCriteria{}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blog := range blogs {
+		if blog.Snippet != "" {
+			t.Errorf("Snippet -> want none without a search; got: %q", blog.Snippet)
+		}
+	}
+}
+
+func testPublishScheduled(t *testing.T, m data.Model) {
+	scheduled := func(at time.Time) func(blog *data.Blog) {
+		return func(blog *data.Blog) {
+			blog.Status = data.StatusScheduled
+			blog.PublishAt = &at
+		}
+	}
+
+	due := newBlog(t, m, "Alpha Post", scheduled(time.Now().Add(-time.Hour)))
+	later := newBlog(t, m, "Bravo Post", scheduled(time.Now().Add(time.Hour)))
+
+	n, err := m.Blog.PublishScheduled(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("PublishScheduled -> want 1; got: %d, %v", n, err)
+	}
+
+	for _, want := range []*data.Blog{
+		{ID: due.ID, Status: data.StatusPublished, Version: due.Version + 1},
+		{ID: later.ID, Status: data.StatusScheduled, Version: later.Version},
+	} {
+		got, err := m.Blog.Get(ctx, want.ID)
+		if err != nil || got.Status != want.Status || got.Version != want.Version {
+			t.Errorf("Published Blog -> want: %s version %d; got: %+v, %v", want.Status, want.Version, got, err)
+		}
+	}
+
+	// Publishing is a change like an update, so the scheduled version is
+	// kept as a revision.
+	revision, err := m.Revision.Get(ctx, due.ID, due.Version)
+	if err != nil || revision.Title != due.Title || revision.Body != due.Body {
+		t.Errorf("Revision -> want the scheduled version; got: %+v, %v", revision, err)
+	}
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "version", SortSafeList: []string{"version"}}
+
+	revisions, _, err := m.Revision.GetAll(ctx, later.ID, f)
+	if err != nil || len(revisions) != 1 || revisions[0].ReplacedAt != nil {
+		t.Errorf("Revisions -> want only the current version of the later blog; got: %d, %v", len(revisions), err)
+	}
+
+	n, err = m.Blog.PublishScheduled(ctx)
+	if err != nil || n != 0 {
+		t.Errorf("PublishScheduled Again -> want 0; got: %d, %v", n, err)
+	}
+}
+
+func testComments(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+	blog := newBlog(t, m, "Alpha Post")
+	other := newBlog(t, m, "Bravo Post")
+
+	byAda := &data.Author{ID: ada.ID}
+
+	root := newComment(t, m, &data.Comment{BlogID: blog.ID, Author: byAda, Body: "First",
+		Status: data.CommentApproved})
+	reply := newComment(t, m, &data.Comment{BlogID: blog.ID, ParentID: &root.ID, Author: byAda,
+		Body: "Reply", Status: data.CommentApproved})
+	deep := newComment(t, m, &data.Comment{BlogID: blog.ID, ParentID: &reply.ID, Body: "Deep reply",
+		Status: data.CommentApproved})
+	second := newComment(t, m, &data.Comment{BlogID: blog.ID, Body: "Second", Status: data.CommentApproved})
+	pending := newComment(t, m, &data.Comment{BlogID: blog.ID, Body: "Held", Status: data.CommentPending,
+		Flags: []string{data.FlagFirstComment}})
+
+	if root.ID < 1 || root.Version != 1 || root.CreatedAt.IsZero() {
+		t.Errorf("Insert -> want id, version 1 and creation time; got: %+v", root)
+	}
+
+	missing := deep.ID + 1000
+
+	for name, parentID := range map[string]int64{"Pending Parent": pending.ID, "Missing Parent": missing} {
+		err := m.Comment.Insert(ctx, &data.Comment{BlogID: blog.ID, ParentID: &parentID, Body: "Reply",
+			Status: data.CommentApproved, Flags: []string{}})
+		wantErr(t, name, err, data.ErrInvalidParent)
+	}
+
+	err := m.Comment.Insert(ctx, &data.Comment{BlogID: other.ID, ParentID: &root.ID, Body: "Reply",
+		Status: data.CommentApproved, Flags: []string{}})
+	wantErr(t, "Parent On Another Blog", err, data.ErrInvalidParent)
+
+	err = m.Comment.Insert(ctx, &data.Comment{BlogID: blog.ID, Body: "", Status: data.CommentApproved,
+		Flags: []string{}})
+	wantConstraintError(t, "Empty Body", err, "body")
+
+	got, err := m.Comment.Get(ctx, reply.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ParentID == nil || *got.ParentID != root.ID || got.Body != "Reply" ||
+		!reflect.DeepEqual(got.Author, &data.Author{ID: ada.ID, Name: "Ada"}) {
+		t.Errorf("Get -> want the reply by Ada; got: %+v", got)
+	}
+
+	got, err = m.Comment.Get(ctx, pending.ID)
+	if err != nil || !reflect.DeepEqual(got.Flags, []string{data.FlagFirstComment}) || got.Author != nil {
+		t.Errorf("Get -> want the flags and no author; got: %+v, %v", got, err)
+	}
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "created_at", SortSafeList: []string{"created_at"}}
+
+	for depth, want := range map[int]string{1: "First(), Second()", 2: "First(Reply()), Second()",
+		3: "First(Reply(Deep reply())), Second()"} {
+		comments, metadata, err := m.Comment.GetAll(ctx, blog.ID, depth, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := thread(comments); got != want {
+			t.Errorf("Depth %d -> want: %s; got: %s", depth, want, got)
+		}
+
+		if metadata.TotalRecords != 2 {
+			t.Errorf("Depth %d -> want 2 top-level comments; got: %d", depth, metadata.TotalRecords)
+		}
+	}
+
+	f.PageSize = 1
+	f.Page = 2
+
+	comments, metadata, err := m.Comment.GetAll(ctx, blog.ID, 3, f)
+	if err != nil || thread(comments) != "Second()" || metadata.LastPage != 2 {
+		t.Errorf("Page 2 -> want the second comment; got: %s, %+v, %v", thread(comments), metadata, err)
+	}
+
+	comments, _, err = m.Comment.GetAll(ctx, other.ID, 3, f)
+	if err != nil || comments == nil || len(comments) != 0 {
+		t.Errorf("Other blog -> want an empty list; got: %v, %v", comments, err)
+	}
+
+	err = m.Comment.Delete(ctx, root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{root.ID, reply.ID, deep.ID} {
+		_, err = m.Comment.Get(ctx, id)
+		wantErr(t, "Get deleted thread", err, data.ErrRecordNotFound)
+	}
+
+	err = m.Comment.Delete(ctx, root.ID)
+	wantErr(t, "Delete deleted", err, data.ErrRecordNotFound)
+
+	err = m.Blog.Delete(ctx, blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Comment.Get(ctx, second.ID)
+	wantErr(t, "Get comment of deleted blog", err, data.ErrRecordNotFound)
+}
+
+// thread describes comments and their nested replies, e.g. "A(B()), C()".
+func thread(comments []*data.Comment) string {
+	var parts []string
+	for _, c := range comments {
+		parts = append(parts, c.Body+"("+thread(c.Replies)+")")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func testCommentModeration(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+	blog := newBlog(t, m, "Alpha Post")
+
+	comment := func(status, ip string) *data.Comment {
+		return newComment(t, m, &data.Comment{BlogID: blog.ID, Author: &data.Author{ID: ada.ID},
+			Body: "A " + status + " comment", Status: status, IP: ip})
+	}
+
+	approved := comment(data.CommentApproved, "192.0.2.1")
+	held := comment(data.CommentPending, "192.0.2.1")
+	spam := comment(data.CommentSpam, "192.0.2.2")
+	heldAgain := comment(data.CommentPending, "192.0.2.1")
+
+	history, err := m.Comment.CommenterHistory(ctx, ada.ID, "192.0.2.1", time.Now().Add(-time.Hour))
+	if err != nil || history != (data.CommenterHistory{ApprovedComments: 1, RecentFromIP: 3}) {
+		t.Errorf("History -> want 1 approved and 3 recent; got: %+v, %v", history, err)
+	}
+
+	history, err = m.Comment.CommenterHistory(ctx, ada.ID, "192.0.2.1", time.Now().Add(time.Hour))
+	if err != nil || history.RecentFromIP != 0 {
+		t.Errorf("History -> want none recent since a later time; got: %+v, %v", history, err)
+	}
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "created_at", SortSafeList: []string{"created_at"}}
+
+	comments, metadata, err := m.Comment.GetAllByStatus(ctx, data.CommentPending, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+
+	if !reflect.DeepEqual(ids, []int64{held.ID, heldAgain.ID}) || metadata.TotalRecords != 2 {
+		t.Errorf("Queue -> want: %v; got: %v, %+v", []int64{held.ID, heldAgain.ID}, ids, metadata)
+	}
+
+	n, err := m.Comment.SetStatus(ctx, data.CommentApproved, held.ID, held.ID, spam.ID, spam.ID+1000)
+	if err != nil || n != 2 {
+		t.Errorf("SetStatus -> want 2 updated; got: %d, %v", n, err)
+	}
+
+	got, err := m.Comment.Get(ctx, held.ID)
+	if err != nil || got.Status != data.CommentApproved || got.Version != 2 {
+		t.Errorf("Get -> want approved at version 2; got: %+v, %v", got, err)
+	}
+
+	comments, _, err = m.Comment.GetAll(ctx, blog.ID, 1, f)
+	if err != nil || len(comments) != 3 || comments[0].ID != approved.ID {
+		t.Errorf("Approved -> want 3 comments; got: %d, %v", len(comments), err)
+	}
+}
+
+func testUsers(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+
+	if ada.ID < 1 || ada.Version != 1 || ada.CreatedAt.IsZero() {
+		t.Errorf("Insert -> want id, version 1 and creation time; got: %+v", ada)
+	}
+
+	duplicate := &data.User{Name: "Ada Again", Email: "ADA@example.com"}
+	if err := duplicate.Password.Set(password); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.User.Insert(ctx, duplicate)
+	wantErr(t, "Insert duplicate email", err, data.ErrDuplicateEmail)
+
+	got, err := m.User.GetByEmail(ctx, "ada@EXAMPLE.com")
+	if err != nil || got.ID != ada.ID || got.Name != "Ada" || !got.Activated {
+		t.Fatalf("GetByEmail -> want Ada; got: %+v, %v", got, err)
+	}
+
+	if ok, err := got.Password.Matches(password); !ok || err != nil {
+		t.Errorf("Password -> want a match; got: %t, %v", ok, err)
+	}
+
+	_, err = m.User.GetByEmail(ctx, "nobody@example.com")
+	wantErr(t, "GetByEmail missing", err, data.ErrRecordNotFound)
+
+	stale := *got
+
+	got.Name = "Ada Lovelace"
+	err = m.User.Update(ctx, got)
+	if err != nil || got.Version != 2 {
+		t.Errorf("Update -> want version 2; got: %d, %v", got.Version, err)
+	}
+
+	err = m.User.Update(ctx, &stale)
+	wantErr(t, "Update stale version", err, data.ErrEditConflict)
+
+	bob := newUser(t, m, "Bob")
+	bob.Email = "Ada@Example.com"
+	err = m.User.Update(ctx, bob)
+	wantErr(t, "Update to a taken email", err, data.ErrDuplicateEmail)
+}
+
+func testRegister(t *testing.T, m data.Model) {
+	ada := &data.User{Name: "Ada", Email: "ada@example.com"}
+	if err := ada.Password.Set(password); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := m.User.Register(ctx, ada, time.Hour, data.PermissionBlogsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ada.ID < 1 || ada.Version != 1 || token.UserID != ada.ID || token.Scope != data.ScopeActivation {
+		t.Errorf("Register -> want the user stored with an activation token; got: %+v, %+v", ada, token)
+	}
+
+	user, err := m.User.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	if err != nil || user.ID != ada.ID || user.Activated {
+		t.Errorf("GetForToken -> want inactive Ada; got: %+v, %v", user, err)
+	}
+
+	permissions, err := m.Permission.GetAllForUser(ctx, ada.ID)
+	want := data.Permissions{data.PermissionBlogsRead}
+	if err != nil || !reflect.DeepEqual(permissions, want) {
+		t.Errorf("GetAllForUser -> want: %v; got: %v, %v", want, permissions, err)
+	}
+
+	duplicate := &data.User{Name: "Ada Again", Email: "ADA@example.com"}
+	if err := duplicate.Password.Set(password); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.User.Register(ctx, duplicate, time.Hour, data.PermissionBlogsRead)
+	wantErr(t, "Register duplicate email", err, data.ErrDuplicateEmail)
+}
+
+func testTokens(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+
+	token, err := m.Token.New(ctx, ada.ID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := m.User.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	if err != nil || user.ID != ada.ID {
+		t.Errorf("GetForToken -> want Ada; got: %+v, %v", user, err)
+	}
+
+	_, err = m.User.GetForToken(ctx, data.ScopeAuthentication, token.Plaintext)
+	wantErr(t, "GetForToken other scope", err, data.ErrRecordNotFound)
+
+	expired, err := m.Token.New(ctx, ada.ID, -time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.User.GetForToken(ctx, data.ScopeAuthentication, expired.Plaintext)
+	wantErr(t, "GetForToken expired", err, data.ErrRecordNotFound)
+
+	err = m.Token.DeleteAllForUser(ctx, data.ScopeActivation, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.User.GetForToken(ctx, data.ScopeActivation, token.Plaintext)
+	wantErr(t, "GetForToken deleted", err, data.ErrRecordNotFound)
+}
+
+func testPermissions(t *testing.T, m data.Model) {
+	ada := newUser(t, m, "Ada")
+
+	permissions, err := m.Permission.GetAllForUser(ctx, ada.ID)
+	if err != nil || len(permissions) != 0 {
+		t.Errorf("GetAllForUser -> want none; got: %v, %v", permissions, err)
+	}
+
+	err = m.Permission.AddForUser(ctx, ada.ID, data.PermissionBlogsWrite, data.PermissionBlogsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Permission.AddForUser(ctx, ada.ID, data.PermissionBlogsRead, "unknown:code")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions, err = m.Permission.GetAllForUser(ctx, ada.ID)
+	want := data.Permissions{data.PermissionBlogsRead, data.PermissionBlogsWrite}
+	if err != nil || !reflect.DeepEqual(permissions, want) {
+		t.Errorf("GetAllForUser -> want: %v; got: %v, %v", want, permissions, err)
+	}
+
+	err = m.Permission.AddForUser(ctx, ada.ID+1000, data.PermissionBlogsRead)
+	wantErr(t, "AddForUser missing user", err, data.ErrRecordNotFound)
+}
+
+func testCancelledContext(t *testing.T, m data.Model) {
+	blog := newBlog(t, m, "Alpha Post")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := m.Blog.Get(cancelled, blog.ID)
+	wantErr(t, "Get", err, context.Canceled)
+
+	f := data.Filter{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+	_, _, err = m.Blog.GetAll(cancelled, data.BlogCriteria{}, f)
+	wantErr(t, "GetAll", err, context.Canceled)
+}
@@ -1,16 +1,34 @@
 package data
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/3n0ugh/BasedWeb/internal/validator"
 	"math"
 	"strings"
 )
 
+// ErrInvalidCursor is returned for cursors that weren't issued for the
+// current sort, or were tampered with.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Filter struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	// Keyset pages from the position encoded in Cursor instead of by Page;
+	// an empty Cursor starts at the first page. Cursors are signed with
+	// CursorKey, so clients can't forge them. The total number of records
+	// is only counted in keyset mode when Count is set.
+	Keyset    bool
+	Cursor    string
+	CursorKey []byte
+	Count     bool
 }
 
 func ValidateFilter(v *validator.Validator, f Filter) {
@@ -21,6 +39,11 @@ func ValidateFilter(v *validator.Validator, f Filter) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.In(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	if f.Keyset {
+		_, err := f.decodeCursor()
+		v.Check(err == nil, "cursor", "invalid cursor")
+	}
 }
 
 func (f Filter) sortColumn() string {
@@ -50,12 +73,133 @@ func (f Filter) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// cursor is the position a keyset page starts after: the sort key and the
+// id of the last row seen, or of the first one when paging backward.
+type cursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k"`
+	ID       int64  `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// encodeCursor returns the opaque form of a cursor, its JSON encoding and
+// HMAC-SHA256 signature in base64.
+func (f Filter) encodeCursor(c cursor) string {
+	c.Sort = f.Sort
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(f.signCursor(payload))
+}
+
+// decodeCursor verifies and decodes the filter's cursor. An empty cursor
+// decodes to the start of the listing.
+func (f Filter) decodeCursor() (cursor, error) {
+	if f.Cursor == "" {
+		return cursor{Sort: f.Sort}, nil
+	}
+
+	parts := strings.Split(f.Cursor, ".")
+	if len(parts) != 2 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, f.signCursor(payload)) {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+
+	err = json.Unmarshal(payload, &c)
+	if err != nil || c.Sort != f.Sort || c.ID < 1 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func (f Filter) signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, f.CursorKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// keyset returns the condition and the ordering selecting the rows after
+// the cursor, with its key and id bound to the $keyArg and $keyArg+1
+// placeholders. The condition is empty at the start of the listing. Rows
+// come in reverse order when paging backward.
+func (f Filter) keyset(c cursor, column, idColumn string, keyArg int) (where string, orderBy string) {
+	direction := f.sortDirection()
+	if c.Backward {
+		direction = map[string]string{"ASC": "DESC", "DESC": "ASC"}[direction]
+	}
+
+	orderBy = fmt.Sprintf("%[1]s %[3]s, %[2]s %[3]s", column, idColumn, direction)
+
+	if c.ID == 0 {
+		return "", orderBy
+	}
+
+	operator := ">"
+	if direction == "DESC" {
+		operator = "<"
+	}
+
+	where = fmt.Sprintf("(%s, %s) %s ($%d, $%d)", column, idColumn, operator, keyArg, keyArg+1)
+
+	return where, orderBy
+}
+
+// keysetMetadata returns the metadata of a keyset page read from the
+// cursor. first and last are the positions of the first and the last rows
+// of the page, and more tells whether rows follow it in the direction read.
+func (f Filter) keysetMetadata(c cursor, more bool, first, last cursor, totalRecords int) Metadata {
+	metadata := Metadata{PageSize: f.PageSize, TotalRecords: totalRecords}
+
+	if first.ID == 0 {
+		return metadata
+	}
+
+	first.Backward = true
+
+	if c.Backward {
+		metadata.NextCursor = f.encodeCursor(last)
+		if more {
+			metadata.PrevCursor = f.encodeCursor(first)
+		}
+	} else {
+		if more {
+			metadata.NextCursor = f.encodeCursor(last)
+		}
+		if c.ID != 0 {
+			metadata.PrevCursor = f.encodeCursor(first)
+		}
+	}
+
+	return metadata
+}
+
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+	// Links holds the URLs of the first, prev, next and last pages by their
+	// link relation.
+	Links map[string]string `json:"links,omitempty"`
 }
 
 // The calculateMetadata() function calculates the appropriate pagination metadata
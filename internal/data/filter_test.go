@@ -0,0 +1,130 @@
+package data
+
+import (
+	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	f := Filter{Sort: "-title", CursorKey: []byte("secret")}
+
+	want := cursor{Sort: "-title", Key: "gRPC in Go!", ID: 11, Backward: true}
+	f.Cursor = f.encodeCursor(want)
+
+	got, err := f.decodeCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("want: %+v; got: %+v", want, got)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{name: "Other Key", filter: Filter{Sort: f.Sort, Cursor: f.Cursor, CursorKey: []byte("other")}},
+		{name: "Other Sort", filter: Filter{Sort: "title", Cursor: f.Cursor, CursorKey: f.CursorKey}},
+		{name: "Tampered", filter: Filter{Sort: f.Sort, Cursor: "x" + f.Cursor, CursorKey: f.CursorKey}},
+		{name: "Garbage", filter: Filter{Sort: f.Sort, Cursor: "abc", CursorKey: f.CursorKey}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.filter.decodeCursor(); err != ErrInvalidCursor {
+				t.Errorf("want: %v; got: %v", ErrInvalidCursor, err)
+			}
+
+			v := validator.New()
+			tt.filter.Keyset = true
+			tt.filter.Page, tt.filter.PageSize = 1, 20
+			tt.filter.SortSafeList = []string{"title", "-title"}
+
+			if ValidateFilter(v, tt.filter); v.Errors["cursor"] == "" {
+				t.Error("want a cursor validation error")
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	tests := []struct {
+		name        string
+		sort        string
+		cursor      cursor
+		wantWhere   string
+		wantOrderBy string
+	}{
+		{name: "Start", sort: "id", cursor: cursor{},
+			wantWhere: "", wantOrderBy: "blogs.id ASC, blogs.id ASC"},
+		{name: "Forward", sort: "title", cursor: cursor{Key: "a", ID: 1},
+			wantWhere: "(blogs.title, blogs.id) > ($7, $8)", wantOrderBy: "blogs.title ASC, blogs.id ASC"},
+		{name: "Forward Descending", sort: "-title", cursor: cursor{Key: "a", ID: 1},
+			wantWhere: "(blogs.title, blogs.id) < ($7, $8)", wantOrderBy: "blogs.title DESC, blogs.id DESC"},
+		{name: "Backward", sort: "title", cursor: cursor{Key: "a", ID: 1, Backward: true},
+			wantWhere: "(blogs.title, blogs.id) < ($7, $8)", wantOrderBy: "blogs.title DESC, blogs.id DESC"},
+		{name: "Backward Descending", sort: "-title", cursor: cursor{Key: "a", ID: 1, Backward: true},
+			wantWhere: "(blogs.title, blogs.id) > ($7, $8)", wantOrderBy: "blogs.title ASC, blogs.id ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filter{Sort: tt.sort, SortSafeList: []string{tt.sort}}
+
+			where, orderBy := f.keyset(tt.cursor, "blogs."+f.sortColumn(), "blogs.id", 7)
+
+			if where != tt.wantWhere {
+				t.Errorf("Where -> want: %q; got: %q", tt.wantWhere, where)
+			}
+
+			if orderBy != tt.wantOrderBy {
+				t.Errorf("Order By -> want: %q; got: %q", tt.wantOrderBy, orderBy)
+			}
+		})
+	}
+}
+
+func TestKeysetMetadata(t *testing.T) {
+	f := Filter{Sort: "id", PageSize: 2}
+	first, last := cursor{Key: "3", ID: 3}, cursor{Key: "4", ID: 4}
+
+	tests := []struct {
+		name     string
+		cursor   cursor
+		more     bool
+		first    cursor
+		wantNext bool
+		wantPrev bool
+	}{
+		{name: "First Page", cursor: cursor{}, more: true, first: first, wantNext: true},
+		{name: "Only Page", cursor: cursor{}, more: false, first: first},
+		{name: "Middle Page", cursor: cursor{ID: 2}, more: true, first: first, wantNext: true, wantPrev: true},
+		{name: "Last Page", cursor: cursor{ID: 2}, more: false, first: first, wantPrev: true},
+		{name: "Back To Middle", cursor: cursor{ID: 5, Backward: true}, more: true, first: first,
+			wantNext: true, wantPrev: true},
+		{name: "Back To First", cursor: cursor{ID: 5, Backward: true}, more: false, first: first, wantNext: true},
+		{name: "Empty Page", cursor: cursor{ID: 2}, more: false, first: cursor{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := f.keysetMetadata(tt.cursor, tt.more, tt.first, last, 0)
+
+			if (metadata.NextCursor != "") != tt.wantNext {
+				t.Errorf("Next Cursor -> want: %t; got: %q", tt.wantNext, metadata.NextCursor)
+			}
+
+			if (metadata.PrevCursor != "") != tt.wantPrev {
+				t.Errorf("Prev Cursor -> want: %t; got: %q", tt.wantPrev, metadata.PrevCursor)
+			}
+
+			if metadata.PrevCursor != "" {
+				prev, err := Filter{Sort: f.Sort, Cursor: metadata.PrevCursor}.decodeCursor()
+				if err != nil || !prev.Backward || prev.ID != first.ID {
+					t.Errorf("Prev Cursor -> want backward from %d; got: %+v (%v)", first.ID, prev, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryStore holds the records of the in-memory models. A single lock
+// guards all of them, so operations spanning several records, such as an
+// update archiving a revision, are atomic like the transactions of the
+// PostgreSQL models.
+type memoryStore struct {
+	mu sync.RWMutex
+
+	blogs     map[int64]*Blog
+	slugs     map[string]int64
+	revisions map[int64][]*Revision
+	comments  map[int64]*Comment
+	users     map[int64]*User
+	tokens    []*Token
+	// permissions holds the granted codes by user id.
+	permissions map[int64]map[string]bool
+
+	lastBlogID    int64
+	lastCommentID int64
+	lastUserID    int64
+}
+
+// memoryPermissions lists the permission codes the migrations create, the
+// only ones that can be granted.
+var memoryPermissions = []string{PermissionBlogsRead, PermissionBlogsWrite, PermissionAdmin,
+	PermissionCommentsModerate}
+
+// NewMemoryModel returns models keeping their records in memory, for tests
+// and for running without a database. They behave like the PostgreSQL models,
+// except that searching matches the words as written whatever the language,
+// and that the records are lost when the process exits.
+func NewMemoryModel() Model {
+	s := &memoryStore{
+		blogs:       make(map[int64]*Blog),
+		slugs:       make(map[string]int64),
+		revisions:   make(map[int64][]*Revision),
+		comments:    make(map[int64]*Comment),
+		users:       make(map[int64]*User),
+		permissions: make(map[int64]map[string]bool),
+	}
+
+	return Model{
+		Blog:       memoryBlogModel{s},
+		Revision:   memoryRevisionModel{s},
+		Comment:    memoryCommentModel{s},
+		User:       memoryUserModel{s},
+		Token:      memoryTokenModel{s},
+		Permission: memoryPermissionModel{s},
+	}
+}
+
+// lock takes the write lock unless the context is already done, in which
+// case its error is returned like a cancelled query would.
+func (s *memoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	return nil
+}
+
+func (s *memoryStore) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	return nil
+}
+
+// memoryNow returns the current time at the precision of the timestamp(0)
+// columns.
+func memoryNow() time.Time {
+	return time.Now().Round(time.Second)
+}
+
+// violation returns the error of a write breaking the named CHECK constraint
+// of the schema.
+func violation(constraint string) error {
+	field := constraintFields[constraint]
+
+	return &ConstraintError{
+		Constraint: constraint,
+		Field:      field.Field,
+		Message:    field.Message,
+		Err:        fmt.Errorf("new row violates check constraint %q", constraint),
+	}
+}
+
+// author returns a copy of a stored author, named after the user when it
+// still exists.
+func (s *memoryStore) author(a *Author) *Author {
+	if a == nil {
+		return nil
+	}
+
+	author := *a
+	if user, ok := s.users[a.ID]; ok {
+		author.Name = user.Name
+	}
+
+	return &author
+}
+
+func copyStrings(values []string) []string {
+	return append([]string{}, values...)
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// page returns the part of the n sorted records the offset filter selects,
+// as the bounds of a slice.
+func (f Filter) page(n int) (start, end int) {
+	start = f.offset()
+	if start > n {
+		start = n
+	}
+
+	end = start + f.limit()
+	if end > n {
+		end = n
+	}
+
+	return start, end
+}
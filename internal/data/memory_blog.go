@@ -0,0 +1,594 @@
+package data
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type memoryBlogModel struct {
+	s *memoryStore
+}
+
+// checkBlog enforces the CHECK constraints of the blogs table.
+func checkBlog(blog *Blog) error {
+	switch n := utf8.RuneCountInString(blog.Title); {
+	case n < 3 || n > 70:
+		return violation("title_length_check")
+	case len(blog.Category) < 1 || len(blog.Category) > 5:
+		return violation("category_length_check")
+	case !contains(BlogStatuses, blog.Status):
+		return violation("status_check")
+	case blog.Status == StatusScheduled && blog.PublishAt == nil:
+		return violation("publish_at_check")
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBlog returns a copy of a stored blog sharing no memory with it.
+func (s *memoryStore) copyBlog(stored *Blog) *Blog {
+	blog := *stored
+	blog.Category = copyStrings(stored.Category)
+	blog.PublishAt = copyTime(stored.PublishAt)
+	blog.Author = s.author(stored.Author)
+	return &blog
+}
+
+// freeSlug returns base, or base with the lowest free collision suffix, that
+// isn't used by any blog other than blogID now or in the past.
+func (s *memoryStore) freeSlug(base string, blogID int64) string {
+	taken := make(map[string]bool)
+	for slug, id := range s.slugs {
+		if id != blogID {
+			taken[slug] = true
+		}
+	}
+
+	return pickSlug(base, taken)
+}
+
+func (b memoryBlogModel) Insert(ctx context.Context, blog *Blog) error {
+	if err := b.s.lock(ctx); err != nil {
+		return err
+	}
+	defer b.s.mu.Unlock()
+
+	if err := checkBlog(blog); err != nil {
+		return err
+	}
+
+	b.s.lastBlogID++
+
+	blog.ID = b.s.lastBlogID
+	blog.CreatedAt = memoryNow()
+	blog.Version = 1
+	blog.Slug = b.s.freeSlug(Slugify(blog.Title), 0)
+
+	stored := b.s.copyBlog(blog)
+	stored.Snippet = ""
+
+	b.s.blogs[blog.ID] = stored
+	b.s.slugs[blog.Slug] = blog.ID
+
+	return nil
+}
+
+func (b memoryBlogModel) Get(ctx context.Context, id int64) (*Blog, error) {
+	if err := b.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer b.s.mu.RUnlock()
+
+	stored, ok := b.s.blogs[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return b.s.copyBlog(stored), nil
+}
+
+func (b memoryBlogModel) GetBySlug(ctx context.Context, slug string) (*Blog, error) {
+	if err := b.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer b.s.mu.RUnlock()
+
+	stored, ok := b.s.blogs[b.s.slugs[slug]]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return b.s.copyBlog(stored), nil
+}
+
+// Update stores the blog if its version is still the one given, and archives
+// the replaced version as a revision.
+func (b memoryBlogModel) Update(ctx context.Context, blog *Blog) error {
+	if err := b.s.lock(ctx); err != nil {
+		return err
+	}
+	defer b.s.mu.Unlock()
+
+	stored, ok := b.s.blogs[blog.ID]
+	if !ok || stored.Version != blog.Version {
+		return ErrEditConflict
+	}
+
+	if err := checkBlog(blog); err != nil {
+		return err
+	}
+
+	b.s.revisions[blog.ID] = append(b.s.revisions[blog.ID], &Revision{
+		BlogID:     stored.ID,
+		Version:    stored.Version,
+		Title:      stored.Title,
+		Body:       stored.Body,
+		Category:   copyStrings(stored.Category),
+		ReplacedAt: timePtr(memoryNow()),
+	})
+
+	if base := Slugify(blog.Title); !slugHasBase(blog.Slug, base) {
+		blog.Slug = b.s.freeSlug(base, blog.ID)
+		if _, ok := b.s.slugs[blog.Slug]; !ok {
+			b.s.slugs[blog.Slug] = blog.ID
+		}
+	}
+
+	blog.Version++
+
+	stored.Title = blog.Title
+	stored.Slug = blog.Slug
+	stored.Body = blog.Body
+	stored.Category = copyStrings(blog.Category)
+	stored.Status = blog.Status
+	stored.PublishAt = copyTime(blog.PublishAt)
+	stored.Version = blog.Version
+
+	return nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// Delete removes the blog along with its slugs, revisions and comments.
+func (b memoryBlogModel) Delete(ctx context.Context, id int64) error {
+	if err := b.s.lock(ctx); err != nil {
+		return err
+	}
+	defer b.s.mu.Unlock()
+
+	if _, ok := b.s.blogs[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(b.s.blogs, id)
+	delete(b.s.revisions, id)
+
+	for slug, blogID := range b.s.slugs {
+		if blogID == id {
+			delete(b.s.slugs, slug)
+		}
+	}
+
+	for commentID, comment := range b.s.comments {
+		if comment.BlogID == id {
+			delete(b.s.comments, commentID)
+		}
+	}
+
+	return nil
+}
+
+// words splits text into lower case words, the way the "simple" text search
+// configuration does.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasWords reports whether all the words are in the set of words.
+func hasWords(set map[string]int, words []string) bool {
+	for _, w := range words {
+		if set[w] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func wordCounts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, w := range words(text) {
+		counts[w]++
+	}
+	return counts
+}
+
+// search is a parsed web search query: alternatives separated by "or", each
+// requiring all of its words and none of the words prefixed with "-".
+// Quoted phrases are matched as separate words.
+type search []searchTerms
+
+type searchTerms struct {
+	include []string
+	exclude []string
+}
+
+func parseSearch(query string) search {
+	s := search{{}}
+
+	for _, field := range strings.Fields(query) {
+		last := &s[len(s)-1]
+
+		switch {
+		case strings.EqualFold(field, "or"):
+			if len(last.include) > 0 {
+				s = append(s, searchTerms{})
+			}
+		case strings.HasPrefix(field, "-"):
+			last.exclude = append(last.exclude, words(field)...)
+		default:
+			last.include = append(last.include, words(field)...)
+		}
+	}
+
+	return s
+}
+
+// rank reports whether the blog matches the search, and how well: words in
+// the title weigh 1 and words in the body 0.4, like the weights of the
+// search vector.
+func (s search) rank(blog *Blog) (float64, bool) {
+	title, body := wordCounts(blog.Title), wordCounts(blog.Body)
+
+	all := make(map[string]int)
+	for w, n := range title {
+		all[w] += n
+	}
+	for w, n := range body {
+		all[w] += n
+	}
+
+	var rank float64
+	matched := false
+
+	for _, alt := range s {
+		if len(alt.include) == 0 || !hasWords(all, alt.include) {
+			continue
+		}
+
+		excluded := false
+		for _, w := range alt.exclude {
+			excluded = excluded || all[w] > 0
+		}
+		if excluded {
+			continue
+		}
+
+		matched = true
+		for _, w := range alt.include {
+			rank += float64(title[w]) + 0.4*float64(body[w])
+		}
+	}
+
+	return rank, matched
+}
+
+// snippet returns up to 35 words of the body starting shortly before the
+// first match, with the matching words put in <mark> tags. The body is
+// HTML-escaped, so the tags are the only markup in the snippet.
+func (s search) snippet(body string) string {
+	terms := make(map[string]bool)
+	for _, alt := range s {
+		for _, w := range alt.include {
+			terms[w] = true
+		}
+	}
+
+	fields := strings.Fields(body)
+	marked := make([]string, len(fields))
+	first := -1
+
+	for i, field := range fields {
+		marked[i] = html.EscapeString(field)
+		for _, w := range words(field) {
+			if terms[w] {
+				marked[i] = "<mark>" + marked[i] + "</mark>"
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+
+	start := 0
+	if first > 5 {
+		start = first - 5
+	}
+
+	end := start + 35
+	if end > len(marked) {
+		end = len(marked)
+	}
+
+	return strings.Join(marked[start:end], " ")
+}
+
+// matches reports whether the blog meets the criteria, other than the query.
+func (c BlogCriteria) matches(blog *Blog) bool {
+	if c.Title != "" {
+		title := words(c.Title)
+		if len(title) == 0 || !hasWords(wordCounts(blog.Title), title) {
+			return false
+		}
+	}
+
+	for _, category := range c.Category {
+		if !contains(blog.Category, category) {
+			return false
+		}
+	}
+
+	if c.AuthorID != 0 && (blog.Author == nil || blog.Author.ID != c.AuthorID) {
+		return false
+	}
+
+	return c.Status == "" || blog.Status == c.Status
+}
+
+// compareBlogs orders two blogs by a sort column, returning -1, 0 or 1.
+func compareBlogs(a, b *Blog, column string, ranks map[int64]float64) int {
+	var less, greater bool
+
+	switch column {
+	case "id":
+		less, greater = a.ID < b.ID, a.ID > b.ID
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "rank":
+		less, greater = ranks[a.ID] < ranks[b.ID], ranks[a.ID] > ranks[b.ID]
+	default:
+		panic("unsupported sort column: " + column)
+	}
+
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// GetAll lists the blogs matching the criteria like BlogModel.GetAll.
+// Titles are sorted by their bytes rather than by the database collation.
+func (b memoryBlogModel) GetAll(ctx context.Context, c BlogCriteria, f Filter) ([]*Blog, Metadata, error) {
+	if err := b.s.rlock(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+	defer b.s.mu.RUnlock()
+
+	var cur cursor
+
+	if f.Keyset {
+		var err error
+
+		cur, err = f.decodeCursor()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	s := parseSearch(c.Query)
+	ranks := make(map[int64]float64)
+	blogs := []*Blog{}
+
+	for _, stored := range b.s.blogs {
+		if !c.matches(stored) {
+			continue
+		}
+
+		blog := b.s.copyBlog(stored)
+
+		if c.Query != "" {
+			rank, ok := s.rank(blog)
+			if !ok {
+				continue
+			}
+
+			ranks[blog.ID] = rank
+			blog.Snippet = s.snippet(blog.Body)
+		}
+
+		blogs = append(blogs, blog)
+	}
+
+	column := f.sortColumn()
+	desc := f.sortDirection() == "DESC"
+
+	if !f.Keyset {
+		// Ties are broken by ascending id whatever the direction.
+		sort.Slice(blogs, func(i, j int) bool {
+			if c := compareBlogs(blogs[i], blogs[j], column, ranks); c != 0 {
+				return (c < 0) != desc
+			}
+			return blogs[i].ID < blogs[j].ID
+		})
+
+		start, end := f.page(len(blogs))
+
+		// Like the window count of the query, the total is only known when
+		// the page has rows.
+		totalRecords := 0
+		if start < end {
+			totalRecords = len(blogs)
+		}
+
+		return blogs[start:end], calculateMetadata(totalRecords, f.Page, f.PageSize), nil
+	}
+
+	totalRecords := 0
+	if f.Count {
+		totalRecords = len(blogs)
+	}
+
+	if cur.Backward {
+		desc = !desc
+	}
+
+	// Keyset pages are ordered by the sort column and the id in the same
+	// direction, and start after the cursor.
+	before := func(a, b *Blog) bool {
+		c := compareBlogs(a, b, column, ranks)
+		if c == 0 {
+			c = compareBlogs(a, b, "id", nil)
+		}
+		return c != 0 && (c < 0) != desc
+	}
+
+	sort.Slice(blogs, func(i, j int) bool { return before(blogs[i], blogs[j]) })
+
+	if cur.ID != 0 {
+		at := &Blog{ID: cur.ID, Title: cur.Key}
+		i := sort.Search(len(blogs), func(i int) bool { return before(at, blogs[i]) })
+		blogs = blogs[i:]
+	}
+
+	more := len(blogs) > f.limit()
+	if more {
+		blogs = blogs[:f.limit()]
+	}
+
+	if cur.Backward {
+		for i, j := 0, len(blogs)-1; i < j; i, j = i+1, j-1 {
+			blogs[i], blogs[j] = blogs[j], blogs[i]
+		}
+	}
+
+	var first, last cursor
+	if len(blogs) > 0 {
+		first = blogCursor(blogs[0], column)
+		last = blogCursor(blogs[len(blogs)-1], column)
+	}
+
+	return blogs, f.keysetMetadata(cur, more, first, last, totalRecords), nil
+}
+
+// PublishScheduled publishes the due scheduled blogs, archiving their
+// scheduled versions as revisions like Update does.
+func (b memoryBlogModel) PublishScheduled(ctx context.Context) (int64, error) {
+	if err := b.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer b.s.mu.Unlock()
+
+	var n int64
+	now := time.Now()
+
+	for _, blog := range b.s.blogs {
+		if blog.Status != StatusScheduled || blog.PublishAt.After(now) {
+			continue
+		}
+
+		b.s.revisions[blog.ID] = append(b.s.revisions[blog.ID], &Revision{
+			BlogID:     blog.ID,
+			Version:    blog.Version,
+			Title:      blog.Title,
+			Body:       blog.Body,
+			Category:   copyStrings(blog.Category),
+			ReplacedAt: timePtr(memoryNow()),
+		})
+
+		blog.Status = StatusPublished
+		blog.Version++
+		n++
+	}
+
+	return n, nil
+}
+
+type memoryRevisionModel struct {
+	s *memoryStore
+}
+
+func copyRevision(stored *Revision) *Revision {
+	revision := *stored
+	revision.Category = copyStrings(stored.Category)
+	revision.ReplacedAt = copyTime(stored.ReplacedAt)
+	return &revision
+}
+
+// GetAll returns a page of the versions of a blog, the current one
+// included, sorted by version. The current version has no ReplacedAt time.
+func (rm memoryRevisionModel) GetAll(ctx context.Context, blogID int64, f Filter) ([]*Revision, Metadata, error) {
+	if err := rm.s.rlock(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rm.s.mu.RUnlock()
+
+	var revisions []*Revision
+
+	if blog, ok := rm.s.blogs[blogID]; ok {
+		revisions = append(revisions, CurrentRevision(rm.s.copyBlog(blog)))
+	}
+
+	for _, stored := range rm.s.revisions[blogID] {
+		revisions = append(revisions, copyRevision(stored))
+	}
+
+	if f.sortColumn() != "version" {
+		panic("unsupported sort column: " + f.sortColumn())
+	}
+
+	descending := f.sortDirection() == "DESC"
+
+	sort.Slice(revisions, func(i, j int) bool {
+		if descending {
+			return revisions[i].Version > revisions[j].Version
+		}
+		return revisions[i].Version < revisions[j].Version
+	})
+
+	start, end := f.page(len(revisions))
+
+	// Like the window count of the query, the total is only known when the
+	// page has rows.
+	totalRecords := 0
+	if start < end {
+		totalRecords = len(revisions)
+	}
+
+	return append([]*Revision{}, revisions[start:end]...), calculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
+func (rm memoryRevisionModel) Get(ctx context.Context, blogID int64, version int32) (*Revision, error) {
+	if err := rm.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer rm.s.mu.RUnlock()
+
+	for _, revision := range rm.s.revisions[blogID] {
+		if revision.Version == version {
+			return copyRevision(revision), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+type memoryCommentModel struct {
+	s *memoryStore
+}
+
+// checkComment enforces the CHECK constraints of the comments table.
+func checkComment(comment *Comment) error {
+	switch n := utf8.RuneCountInString(comment.Body); {
+	case n < 1 || n > 5000:
+		return violation("comments_body_length_check")
+	case !contains(CommentStatuses, comment.Status):
+		return violation("comments_status_check")
+	}
+
+	return nil
+}
+
+// copyComment returns a copy of a stored comment without its replies. The IP
+// address isn't returned, like the columns the PostgreSQL model reads.
+func (s *memoryStore) copyComment(stored *Comment) *Comment {
+	comment := *stored
+	comment.Flags = copyStrings(stored.Flags)
+	comment.Author = s.author(stored.Author)
+	comment.IP = ""
+	comment.Replies = nil
+
+	if stored.ParentID != nil {
+		parentID := *stored.ParentID
+		comment.ParentID = &parentID
+	}
+
+	return &comment
+}
+
+// Insert stores a new comment. A reply is only stored when its parent is an
+// approved comment on the same blog, otherwise ErrInvalidParent is returned.
+// Comments on missing blogs get ErrRecordNotFound.
+func (cm memoryCommentModel) Insert(ctx context.Context, comment *Comment) error {
+	if err := cm.s.lock(ctx); err != nil {
+		return err
+	}
+	defer cm.s.mu.Unlock()
+
+	if comment.ParentID != nil {
+		parent, ok := cm.s.comments[*comment.ParentID]
+		if !ok || parent.BlogID != comment.BlogID || parent.Status != CommentApproved {
+			return ErrInvalidParent
+		}
+	}
+
+	if err := checkComment(comment); err != nil {
+		return err
+	}
+
+	if _, ok := cm.s.blogs[comment.BlogID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	cm.s.lastCommentID++
+
+	comment.ID = cm.s.lastCommentID
+	comment.CreatedAt = memoryNow()
+	comment.Version = 1
+
+	stored := cm.s.copyComment(comment)
+	stored.IP = comment.IP
+
+	cm.s.comments[comment.ID] = stored
+
+	return nil
+}
+
+func (cm memoryCommentModel) Get(ctx context.Context, id int64) (*Comment, error) {
+	if err := cm.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer cm.s.mu.RUnlock()
+
+	stored, ok := cm.s.comments[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return cm.s.copyComment(stored), nil
+}
+
+// Delete removes a comment together with all the replies below it.
+func (cm memoryCommentModel) Delete(ctx context.Context, id int64) error {
+	if err := cm.s.lock(ctx); err != nil {
+		return err
+	}
+	defer cm.s.mu.Unlock()
+
+	if _, ok := cm.s.comments[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	ids := []int64{id}
+
+	for len(ids) > 0 {
+		parentID := ids[0]
+		ids = ids[1:]
+
+		delete(cm.s.comments, parentID)
+
+		for _, comment := range cm.s.comments {
+			if comment.ParentID != nil && *comment.ParentID == parentID {
+				ids = append(ids, comment.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortComments orders comments by the filter's sort column, then by
+// ascending id.
+func sortComments(comments []*Comment, f Filter) {
+	column := f.sortColumn()
+	desc := f.sortDirection() == "DESC"
+
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+
+		switch column {
+		case "created_at":
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt) != desc
+			}
+		case "id":
+			return (a.ID < b.ID) != desc
+		default:
+			panic("unsupported sort column: " + column)
+		}
+
+		return a.ID < b.ID
+	})
+}
+
+// pageComments returns the page of the sorted comments the filter selects,
+// and its metadata.
+func pageComments(comments []*Comment, f Filter) ([]*Comment, Metadata) {
+	start, end := f.page(len(comments))
+
+	// Like the window count of the query, the total is only known when the
+	// page has rows.
+	totalRecords := 0
+	if start < end {
+		totalRecords = len(comments)
+	}
+
+	return comments[start:end], calculateMetadata(totalRecords, f.Page, f.PageSize)
+}
+
+// GetAll returns a page of the approved top-level comments of a blog, each
+// with its approved replies nested below it down to the given depth.
+func (cm memoryCommentModel) GetAll(ctx context.Context, blogID int64, depth int, f Filter) ([]*Comment, Metadata, error) {
+	if err := cm.s.rlock(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+	defer cm.s.mu.RUnlock()
+
+	roots := []*Comment{}
+	replies := make(map[int64][]*Comment)
+
+	for _, stored := range cm.s.comments {
+		if stored.BlogID != blogID || stored.Status != CommentApproved {
+			continue
+		}
+
+		comment := cm.s.copyComment(stored)
+
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else {
+			replies[*comment.ParentID] = append(replies[*comment.ParentID], comment)
+		}
+	}
+
+	sortComments(roots, f)
+	comments, metadata := pageComments(roots, f)
+
+	oldestFirst := Filter{Sort: "created_at", SortSafeList: []string{"created_at"}}
+
+	var nest func(comment *Comment, level int)
+	nest = func(comment *Comment, level int) {
+		if level >= depth {
+			return
+		}
+
+		comment.Replies = replies[comment.ID]
+		sortComments(comment.Replies, oldestFirst)
+
+		for _, reply := range comment.Replies {
+			nest(reply, level+1)
+		}
+	}
+
+	for _, comment := range comments {
+		nest(comment, 1)
+	}
+
+	return comments, metadata, nil
+}
+
+// GetAllByStatus returns a page of the comments in a moderation state across
+// all blogs, without nesting the replies.
+func (cm memoryCommentModel) GetAllByStatus(ctx context.Context, status string, f Filter) ([]*Comment, Metadata, error) {
+	if err := cm.s.rlock(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+	defer cm.s.mu.RUnlock()
+
+	comments := []*Comment{}
+
+	for _, stored := range cm.s.comments {
+		if stored.Status == status {
+			comments = append(comments, cm.s.copyComment(stored))
+		}
+	}
+
+	sortComments(comments, f)
+	comments, metadata := pageComments(comments, f)
+
+	return comments, metadata, nil
+}
+
+// SetStatus moves the comments with the given ids to a moderation state and
+// returns how many of them exist.
+func (cm memoryCommentModel) SetStatus(ctx context.Context, status string, ids ...int64) (int64, error) {
+	if err := cm.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer cm.s.mu.Unlock()
+
+	if !contains(CommentStatuses, status) {
+		return 0, violation("comments_status_check")
+	}
+
+	seen := make(map[int64]bool)
+	var n int64
+
+	for _, id := range ids {
+		comment, ok := cm.s.comments[id]
+		if !ok || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		comment.Status = status
+		comment.Version++
+		n++
+	}
+
+	return n, nil
+}
+
+// CommenterHistory counts the approved comments of a user, and the comments
+// posted from an IP address since the given time.
+func (cm memoryCommentModel) CommenterHistory(ctx context.Context, authorID int64, ip string, since time.Time) (CommenterHistory, error) {
+	if err := cm.s.rlock(ctx); err != nil {
+		return CommenterHistory{}, err
+	}
+	defer cm.s.mu.RUnlock()
+
+	var history CommenterHistory
+
+	for _, comment := range cm.s.comments {
+		if comment.IsAuthor(authorID) && comment.Status == CommentApproved {
+			history.ApprovedComments++
+		}
+		if comment.IP == ip && !comment.CreatedAt.Before(since) {
+			history.RecentFromIP++
+		}
+	}
+
+	return history, nil
+}
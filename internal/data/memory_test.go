@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMemoryConcurrentUpdates(t *testing.T) {
+	model := NewMemoryModel()
+	ctx := context.Background()
+
+	blog := validBlog()
+	if err := model.Blog.Insert(ctx, blog); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every writer starts from version 1, so only one of them may win.
+	const writers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			update := *blog
+			update.Body = "Updated concurrently"
+			errs <- model.Blog.Update(ctx, &update)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	updated, conflicts := 0, 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			updated++
+		case errors.Is(err, ErrEditConflict):
+			conflicts++
+		default:
+			t.Fatal(err)
+		}
+	}
+
+	if updated != 1 || conflicts != writers-1 {
+		t.Errorf("want 1 update and %d conflicts; got: %d and %d", writers-1, updated, conflicts)
+	}
+
+	f := Filter{Page: 1, PageSize: 10, Sort: "version", SortSafeList: []string{"version"}}
+
+	revisions, _, err := model.Revision.GetAll(ctx, blog.ID, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revisions) != 2 || revisions[0].Version != 1 || revisions[0].ReplacedAt == nil {
+		t.Errorf("want version 1 archived once; got: %d revisions", len(revisions))
+	}
+}
+
+func TestMemoryBlogGetAll(t *testing.T) {
+	model := NewMemoryModel()
+	ctx := context.Background()
+
+	titles := []string{"Go channels", "Rust traits", "Go generics", "Zig comptime"}
+	for i, title := range titles {
+		blog := validBlog()
+		blog.Title = title
+		blog.Category = []string{"Languages"}
+		if i%2 == 0 {
+			blog.Category = append(blog.Category, "Golang")
+		}
+
+		if err := model.Blog.Insert(ctx, blog); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		criteria  BlogCriteria
+		sort      string
+		wantIDs   []int64
+		wantTotal int
+	}{
+		{name: "All", sort: "id", wantIDs: []int64{1, 2}, wantTotal: 4},
+		{name: "By Title Descending", sort: "-title", wantIDs: []int64{4, 2}, wantTotal: 4},
+		{name: "Title Words", criteria: BlogCriteria{Title: "go"}, sort: "id", wantIDs: []int64{1, 3},
+			wantTotal: 2},
+		{name: "Category", criteria: BlogCriteria{Category: []string{"Golang", "Languages"}}, sort: "-id",
+			wantIDs: []int64{3, 1}, wantTotal: 2},
+		{name: "No Match", criteria: BlogCriteria{Title: "java"}, sort: "id", wantIDs: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filter{Page: 1, PageSize: 2, Sort: tt.sort, SortSafeList: []string{"id", "-id", "title", "-title"}}
+
+			blogs, metadata, err := model.Blog.GetAll(ctx, tt.criteria, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, blog := range blogs {
+				ids = append(ids, blog.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("IDs -> want: %v; got: %v", tt.wantIDs, ids)
+			}
+
+			if metadata.TotalRecords != tt.wantTotal {
+				t.Errorf("Total -> want: %d; got: %d", tt.wantTotal, metadata.TotalRecords)
+			}
+		})
+	}
+}
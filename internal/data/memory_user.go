@@ -0,0 +1,266 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryUserModel struct {
+	s *memoryStore
+}
+
+// copyUser returns a copy of a stored user. Like the users table, the store
+// only keeps the hash of the password.
+func copyUser(stored *User) *User {
+	user := *stored
+	user.Password.plaintext = nil
+	user.Password.hash = append([]byte(nil), stored.Password.hash...)
+	return &user
+}
+
+// emailTaken reports whether a user other than userID has the email address,
+// which is compared case-insensitively like the citext column.
+func (s *memoryStore) emailTaken(email string, userID int64) bool {
+	for _, user := range s.users {
+		if user.ID != userID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u memoryUserModel) Insert(ctx context.Context, user *User) error {
+	if err := u.s.lock(ctx); err != nil {
+		return err
+	}
+	defer u.s.mu.Unlock()
+
+	if u.s.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	u.s.lastUserID++
+
+	user.ID = u.s.lastUserID
+	user.CreatedAt = memoryNow()
+	user.Version = 1
+
+	u.s.users[user.ID] = copyUser(user)
+
+	return nil
+}
+
+// Register stores a new user, grants them the permission codes and creates
+// their activation token, all under one lock.
+func (u memoryUserModel) Register(ctx context.Context, user *User, ttl time.Duration, codes ...string) (*Token, error) {
+	token, err := generateToken(0, ttl, ScopeActivation)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer u.s.mu.Unlock()
+
+	if u.s.emailTaken(user.Email, 0) {
+		return nil, ErrDuplicateEmail
+	}
+
+	u.s.lastUserID++
+
+	user.ID = u.s.lastUserID
+	user.CreatedAt = memoryNow()
+	user.Version = 1
+
+	u.s.users[user.ID] = copyUser(user)
+
+	for _, code := range codes {
+		if !contains(memoryPermissions, code) {
+			continue
+		}
+
+		if u.s.permissions[user.ID] == nil {
+			u.s.permissions[user.ID] = make(map[string]bool)
+		}
+
+		u.s.permissions[user.ID][code] = true
+	}
+
+	token.UserID = user.ID
+
+	stored := *token
+	stored.Plaintext = ""
+	stored.Hash = append([]byte(nil), token.Hash...)
+
+	u.s.tokens = append(u.s.tokens, &stored)
+
+	return token, nil
+}
+
+func (u memoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := u.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer u.s.mu.RUnlock()
+
+	for _, user := range u.s.users {
+		if strings.EqualFold(user.Email, email) {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// GetForToken returns the user owning a non-expired token of the given scope.
+func (u memoryUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	if err := u.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer u.s.mu.RUnlock()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	now := time.Now()
+
+	for _, token := range u.s.tokens {
+		if bytes.Equal(token.Hash, tokenHash[:]) && token.Scope == tokenScope && token.Expiry.After(now) {
+			if user, ok := u.s.users[token.UserID]; ok {
+				return copyUser(user), nil
+			}
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (u memoryUserModel) Update(ctx context.Context, user *User) error {
+	if err := u.s.lock(ctx); err != nil {
+		return err
+	}
+	defer u.s.mu.Unlock()
+
+	stored, ok := u.s.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	if u.s.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	user.Version++
+
+	updated := copyUser(user)
+	updated.CreatedAt = stored.CreatedAt
+
+	u.s.users[user.ID] = updated
+
+	return nil
+}
+
+type memoryTokenModel struct {
+	s *memoryStore
+}
+
+// New generates a token for the given user and scope and stores its hash.
+func (t memoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Insert(ctx, token)
+	return token, err
+}
+
+// Insert stores the token. Tokens of missing users get ErrRecordNotFound.
+func (t memoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	if err := t.s.lock(ctx); err != nil {
+		return err
+	}
+	defer t.s.mu.Unlock()
+
+	if _, ok := t.s.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	stored := *token
+	stored.Plaintext = ""
+	stored.Hash = append([]byte(nil), token.Hash...)
+
+	t.s.tokens = append(t.s.tokens, &stored)
+
+	return nil
+}
+
+func (t memoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	if err := t.s.lock(ctx); err != nil {
+		return err
+	}
+	defer t.s.mu.Unlock()
+
+	kept := t.s.tokens[:0]
+
+	for _, token := range t.s.tokens {
+		if token.Scope != scope || token.UserID != userID {
+			kept = append(kept, token)
+		}
+	}
+
+	t.s.tokens = kept
+
+	return nil
+}
+
+type memoryPermissionModel struct {
+	s *memoryStore
+}
+
+func (p memoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	if err := p.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.s.mu.RUnlock()
+
+	var permissions Permissions
+
+	for code := range p.s.permissions[userID] {
+		permissions = append(permissions, code)
+	}
+
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+// AddForUser grants the given permission codes to the user. Codes the user
+// already has, and unknown codes, are skipped.
+func (p memoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	if err := p.s.lock(ctx); err != nil {
+		return err
+	}
+	defer p.s.mu.Unlock()
+
+	if _, ok := p.s.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	for _, code := range codes {
+		if !contains(memoryPermissions, code) {
+			continue
+		}
+
+		if p.s.permissions[userID] == nil {
+			p.s.permissions[userID] = make(map[string]bool)
+		}
+
+		p.s.permissions[userID][code] = true
+	}
+
+	return nil
+}
@@ -5,47 +5,22 @@ import (
 	"time"
 )
 
+// Blog is a published blog written by User. It was renamed once, so its
+// first version is stored as a revision and OldSlug redirects to it.
 var Blog = &data.Blog{
-	ID:        11,
+	ID:        1,
 	CreatedAt: time.Now(),
 	Title:     "gRPC in Go!",
+	Slug:      "grpc-in-go",
 	Body:      "I do not know yet",
 	Category:  []string{"Golang", "Network"},
-	Version:   3,
+	Author:    &data.Author{ID: User.ID, Name: User.Name},
+	Status:    data.StatusPublished,
+	Version:   2,
 }
 
-type BlogModel struct {
-}
-
-func (b BlogModel) Insert(blog *data.Blog) error {
-	blog.ID = Blog.ID
-	blog.Version = Blog.Version
-	blog.CreatedAt = Blog.CreatedAt
-	return nil
-}
-
-func (b BlogModel) Get(id int64) (*data.Blog, error) {
-	if id == Blog.ID {
-		return Blog, nil
-	}
-	return nil, data.ErrRecordNotFound
-}
+// OldSlug is a slug Blog had before its title was changed.
+var OldSlug = "grpc-with-go"
 
-func (b BlogModel) Update(blog *data.Blog) error {
-	if blog.ID != Blog.ID {
-		return data.ErrEditConflict
-	}
-	return nil
-}
-
-func (b BlogModel) Delete(id int64) error {
-	if id == Blog.ID {
-		return nil
-	}
-	return data.ErrRecordNotFound
-}
-
-// TODO: Mock GetAll database function
-func (b BlogModel) GetAll(title string, category []string, f data.Filter) ([]*data.Blog, data.Metadata, error) {
-	return nil, data.Metadata{}, nil
-}
+// OldTitle is the title Blog had in its first version.
+var OldTitle = "gRPC with Go"
@@ -0,0 +1,17 @@
+package mock
+
+import (
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"time"
+)
+
+// Comment is an approved comment of User on Blog.
+var Comment = &data.Comment{
+	ID:        1,
+	CreatedAt: time.Now(),
+	BlogID:    Blog.ID,
+	Author:    &data.Author{ID: User.ID, Name: User.Name},
+	Body:      "Thanks, waiting for the next part.",
+	Status:    data.CommentApproved,
+	Version:   1,
+}
@@ -1,11 +1,47 @@
 package mock
 
 import (
+	"context"
+	"fmt"
 	"github.com/3n0ugh/BasedWeb/internal/data"
 )
 
+// NewModel returns in-memory models holding User, Blog and Comment. The
+// records get the ids, versions and slugs of the fixtures, so tests can
+// compare them with what the handlers return.
 func NewModel() data.Model {
-	return data.Model{
-		Blog: BlogModel{},
+	model := data.NewMemoryModel()
+	ctx := context.Background()
+
+	user := withPassword()
+	must(model.User.Insert(ctx, &user))
+	must(model.Permission.AddForUser(ctx, user.ID, data.PermissionBlogsRead, data.PermissionBlogsWrite))
+
+	blog := *Blog
+	blog.Title = OldTitle
+	blog.Category = append([]string{}, Blog.Category...)
+	must(model.Blog.Insert(ctx, &blog))
+
+	blog.Title = Blog.Title
+	must(model.Blog.Update(ctx, &blog))
+
+	comment := *Comment
+	must(model.Comment.Insert(ctx, &comment))
+
+	switch {
+	case user.ID != User.ID:
+		panic(fmt.Sprintf("mock: user stored with id %d", user.ID))
+	case blog.ID != Blog.ID || blog.Slug != Blog.Slug || blog.Version != Blog.Version:
+		panic(fmt.Sprintf("mock: blog stored as %d %q version %d", blog.ID, blog.Slug, blog.Version))
+	case comment.ID != Comment.ID:
+		panic(fmt.Sprintf("mock: comment stored with id %d", comment.ID))
+	}
+
+	return model
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
 	}
 }
@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"sync"
+	"time"
+)
+
+// Password is the plaintext password of User.
+const Password = "pa55word1234"
+
+// User is an activated user holding the blogs:read and blogs:write
+// permissions.
+var User = &data.User{
+	ID:        1,
+	CreatedAt: time.Now(),
+	Name:      "Gopher",
+	Email:     "gopher@example.com",
+	Activated: true,
+	Version:   1,
+}
+
+// hashed holds the hash of Password, computed once as bcrypt is slow.
+var hashed struct {
+	once sync.Once
+	user data.User
+}
+
+// withPassword returns a copy of User with the hash of Password set.
+func withPassword() data.User {
+	hashed.once.Do(func() {
+		err := hashed.user.Password.Set(Password)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	user := *User
+	user.Password = hashed.user.Password
+
+	return user
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -10,23 +12,57 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
-// TODO: Add token model
-
 type Model struct {
 	Blog interface {
-		Insert(blog *Blog) error
-		Get(id int64) (*Blog, error)
-		Update(blog *Blog) error
-		Delete(id int64) error
-		GetAll(title string, category []string, f Filter) ([]*Blog, Metadata, error)
+		Insert(ctx context.Context, blog *Blog) error
+		Get(ctx context.Context, id int64) (*Blog, error)
+		GetBySlug(ctx context.Context, slug string) (*Blog, error)
+		Update(ctx context.Context, blog *Blog) error
+		Delete(ctx context.Context, id int64) error
+		GetAll(ctx context.Context, c BlogCriteria, f Filter) ([]*Blog, Metadata, error)
+		PublishScheduled(ctx context.Context) (int64, error)
+	}
+	Revision interface {
+		GetAll(ctx context.Context, blogID int64, f Filter) ([]*Revision, Metadata, error)
+		Get(ctx context.Context, blogID int64, version int32) (*Revision, error)
+	}
+	Comment interface {
+		Insert(ctx context.Context, comment *Comment) error
+		Get(ctx context.Context, id int64) (*Comment, error)
+		Delete(ctx context.Context, id int64) error
+		GetAll(ctx context.Context, blogID int64, depth int, f Filter) ([]*Comment, Metadata, error)
+		GetAllByStatus(ctx context.Context, status string, f Filter) ([]*Comment, Metadata, error)
+		SetStatus(ctx context.Context, status string, ids ...int64) (int64, error)
+		CommenterHistory(ctx context.Context, authorID int64, ip string, since time.Time) (CommenterHistory, error)
 	}
 	User interface {
+		Insert(ctx context.Context, user *User) error
+		Register(ctx context.Context, user *User, ttl time.Duration, codes ...string) (*Token, error)
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+		Update(ctx context.Context, user *User) error
+	}
+	Token interface {
+		New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+		Insert(ctx context.Context, token *Token) error
+		DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	}
+	Permission interface {
+		GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+		AddForUser(ctx context.Context, userID int64, codes ...string) error
 	}
 }
 
-func NewModel(db *sql.DB) Model {
+// NewModel returns the PostgreSQL implementation of the models. Every query
+// is bounded by the timeout, on top of the deadline of the context it is
+// given.
+func NewModel(db *sql.DB, timeout time.Duration) Model {
 	return Model{
-		Blog: BlogModel{DB: db},
-		User: UserModel{DB: db},
+		Blog:       BlogModel{DB: db, Timeout: timeout},
+		Revision:   RevisionModel{DB: db, Timeout: timeout},
+		Comment:    CommentModel{DB: db, Timeout: timeout},
+		User:       UserModel{DB: db, Timeout: timeout},
+		Token:      TokenModel{DB: db, Timeout: timeout},
+		Permission: PermissionModel{DB: db, Timeout: timeout},
 	}
 }
@@ -0,0 +1,57 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/3n0ugh/BasedWeb/internal/data"
+	"github.com/3n0ugh/BasedWeb/internal/data/datatest"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	"github.com/3n0ugh/BasedWeb/internal/migrate"
+	"github.com/3n0ugh/BasedWeb/migrations"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemoryModel(t *testing.T) {
+	datatest.Run(t, func(t *testing.T) data.Model {
+		return data.NewMemoryModel()
+	})
+}
+
+// TestPostgresModel runs the suite against the database BASEDWEB_TEST_DB_DSN
+// points to, after migrating it. All of its records are deleted before every
+// test, so it must be a database used for nothing else.
+func TestPostgresModel(t *testing.T) {
+	dsn := os.Getenv("BASEDWEB_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("BASEDWEB_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	files, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrate.New(db, files, jsonlog.New(io.Discard, jsonlog.LevelOff)).Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datatest.Run(t, func(t *testing.T) data.Model {
+		_, err := db.Exec(`TRUNCATE blogs, blog_slugs, blog_revisions, comments, users, tokens,
+			users_permissions RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data.NewModel(db, 5*time.Second)
+	})
+}
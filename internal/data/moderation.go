@@ -0,0 +1,101 @@
+package data
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+)
+
+// CommentStatuses lists the moderation states of a comment. Only approved
+// comments are shown under a blog.
+var CommentStatuses = []string{CommentPending, CommentApproved, CommentSpam}
+
+// The flags record which moderation rules a comment broke.
+const (
+	FlagBannedWord   = "banned_word"
+	FlagTooManyLinks = "too_many_links"
+	FlagFirstComment = "first_comment"
+	FlagIPVelocity   = "ip_velocity"
+)
+
+// ModerationRules decide the status of a new comment. Comments containing a
+// banned word, or posted too often from the same IP address, are spam.
+// Comments with too many links, and the first comment of a user, wait for a
+// moderator. Everything else is approved right away.
+type ModerationRules struct {
+	BannedWords      []string
+	MaxLinks         int
+	HoldFirstComment bool
+	// MaxPerIP is how many comments an IP address may post within IPWindow.
+	// Zero disables the limit.
+	MaxPerIP int
+	IPWindow time.Duration
+}
+
+// CommenterHistory is what the moderation rules need to know about the past
+// comments of the user and the IP address posting a new comment.
+type CommenterHistory struct {
+	ApprovedComments int
+	RecentFromIP     int
+}
+
+var linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// Moderate sets the status and the flags of a new comment.
+func (mr ModerationRules) Moderate(comment *Comment, history CommenterHistory) {
+	comment.Flags = []string{}
+
+	if mr.containsBannedWord(comment.Body) {
+		comment.Flags = append(comment.Flags, FlagBannedWord)
+	}
+
+	if mr.MaxPerIP > 0 && history.RecentFromIP >= mr.MaxPerIP {
+		comment.Flags = append(comment.Flags, FlagIPVelocity)
+	}
+
+	spam := len(comment.Flags) > 0
+
+	if len(linkRX.FindAllString(comment.Body, -1)) > mr.MaxLinks {
+		comment.Flags = append(comment.Flags, FlagTooManyLinks)
+	}
+
+	if mr.HoldFirstComment && history.ApprovedComments == 0 {
+		comment.Flags = append(comment.Flags, FlagFirstComment)
+	}
+
+	switch {
+	case spam:
+		comment.Status = CommentSpam
+	case len(comment.Flags) > 0:
+		comment.Status = CommentPending
+	default:
+		comment.Status = CommentApproved
+	}
+}
+
+func (mr ModerationRules) containsBannedWord(body string) bool {
+	if len(mr.BannedWords) == 0 {
+		return false
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		for _, banned := range mr.BannedWords {
+			if word == strings.ToLower(banned) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
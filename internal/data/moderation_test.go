@@ -0,0 +1,66 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestModerate(t *testing.T) {
+	rules := ModerationRules{
+		BannedWords:      []string{"Casino"},
+		MaxLinks:         1,
+		HoldFirstComment: true,
+		MaxPerIP:         3,
+		IPWindow:         10 * time.Minute,
+	}
+
+	regular := CommenterHistory{ApprovedComments: 4, RecentFromIP: 1}
+
+	tests := []struct {
+		name      string
+		rules     ModerationRules
+		body      string
+		history   CommenterHistory
+		wantState string
+		wantFlags []string
+	}{
+		{name: "Clean", rules: rules, body: "Nice write-up, thanks!", history: regular,
+			wantState: CommentApproved, wantFlags: []string{}},
+		{name: "Banned Word", rules: rules, body: "Visit my CASINO today.", history: regular,
+			wantState: CommentSpam, wantFlags: []string{FlagBannedWord}},
+		{name: "Banned Word Inside Another Word", rules: rules, body: "Casinos are boring.", history: regular,
+			wantState: CommentApproved, wantFlags: []string{}},
+		{name: "One Link", rules: rules, body: "See https://go.dev for more.", history: regular,
+			wantState: CommentApproved, wantFlags: []string{}},
+		{name: "Too Many Links", rules: rules, body: "https://a.example and www.b.example", history: regular,
+			wantState: CommentPending, wantFlags: []string{FlagTooManyLinks}},
+		{name: "First Comment", rules: rules, body: "Hello!", history: CommenterHistory{},
+			wantState: CommentPending, wantFlags: []string{FlagFirstComment}},
+		{name: "First Comment Not Held", rules: ModerationRules{MaxLinks: 1}, body: "Hello!",
+			history: CommenterHistory{}, wantState: CommentApproved, wantFlags: []string{}},
+		{name: "IP Velocity", rules: rules, body: "Hello again!", history: CommenterHistory{ApprovedComments: 4, RecentFromIP: 3},
+			wantState: CommentSpam, wantFlags: []string{FlagIPVelocity}},
+		{name: "IP Velocity Disabled", rules: ModerationRules{MaxLinks: 1}, body: "Hello again!",
+			history: CommenterHistory{RecentFromIP: 300}, wantState: CommentApproved, wantFlags: []string{}},
+		{name: "Spam Wins Over Pending", rules: rules, body: "casino https://a.example https://b.example",
+			history: CommenterHistory{}, wantState: CommentSpam,
+			wantFlags: []string{FlagBannedWord, FlagTooManyLinks, FlagFirstComment}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := &Comment{Body: tt.body}
+
+			tt.rules.Moderate(comment, tt.history)
+
+			if comment.Status != tt.wantState {
+				t.Errorf("Status -> want: %q; got: %q", tt.wantState, comment.Status)
+			}
+
+			if !reflect.DeepEqual(comment.Flags, tt.wantFlags) {
+				t.Errorf("Flags -> want: %q; got: %q", tt.wantFlags, comment.Flags)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	PermissionBlogsRead  = "blogs:read"
+	PermissionBlogsWrite = "blogs:write"
+	PermissionAdmin      = "admin"
+	// PermissionCommentsModerate lets a user review the comments held by
+	// the moderation rules.
+	PermissionCommentsModerate = "comments:moderate"
+)
+
+// GrantablePermissions lists the codes an admin may grant to other users.
+var GrantablePermissions = []string{PermissionBlogsRead, PermissionBlogsWrite, PermissionCommentsModerate}
+
+type Permissions []string
+
+// Include returns true if the permission code is in the Permissions slice.
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+type PermissionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (p PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err = rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants the given permission codes to the user. Codes the user
+// already has are skipped.
+func (p PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `INSERT INTO users_permissions
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		var pqErr *pq.Error
+
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == "users_permissions_user_id_fkey":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Revision is a version of a blog's content. Prior versions are stored by
+// BlogModel.Update when they are replaced; the current version has no
+// ReplacedAt time.
+type Revision struct {
+	BlogID     int64      `json:"blog_id"`
+	Version    int32      `json:"version"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	Category   []string   `json:"category"`
+	ReplacedAt *time.Time `json:"replaced_at,omitempty"`
+}
+
+// CurrentRevision returns the blog's current content as a revision.
+func CurrentRevision(blog *Blog) *Revision {
+	return &Revision{
+		BlogID:   blog.ID,
+		Version:  blog.Version,
+		Title:    blog.Title,
+		Body:     blog.Body,
+		Category: blog.Category,
+	}
+}
+
+type RevisionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// GetAll returns a page of the versions of a blog, the current one
+// included, sorted by version. The current version has no ReplacedAt time.
+func (rm RevisionModel) GetAll(ctx context.Context, blogID int64, f Filter) ([]*Revision, Metadata, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), version, replaced_at, title, body, category
+		FROM (
+			SELECT version, NULL::timestamptz AS replaced_at, title, body, category
+			FROM blogs
+			WHERE id = $1
+			UNION ALL
+			SELECT version, replaced_at, title, body, category
+			FROM blog_revisions
+			WHERE blog_id = $1
+		) AS revisions
+		ORDER BY %s %s
+		LIMIT $2 OFFSET $3`, f.sortColumn(), f.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, rm.Timeout)
+	defer cancel()
+
+	rows, err := rm.DB.QueryContext(ctx, query, blogID, f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		revision := Revision{BlogID: blogID}
+		var replacedAt sql.NullTime
+
+		err = rows.Scan(
+			&totalRecords,
+			&revision.Version,
+			&replacedAt,
+			&revision.Title,
+			&revision.Body,
+			pq.Array(&revision.Category))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revision.ReplacedAt = scanTime(replacedAt)
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, f.Page, f.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// Get returns a stored prior version of a blog.
+func (rm RevisionModel) Get(ctx context.Context, blogID int64, version int32) (*Revision, error) {
+	query := `SELECT replaced_at, title, body, category
+		FROM blog_revisions
+		WHERE blog_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, rm.Timeout)
+	defer cancel()
+
+	revision := Revision{BlogID: blogID, Version: version}
+	var replacedAt time.Time
+
+	err := rm.DB.QueryRowContext(ctx, query, blogID, version).Scan(
+		&replacedAt,
+		&revision.Title,
+		&revision.Body,
+		pq.Array(&revision.Category))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	revision.ReplacedAt = &replacedAt
+
+	return &revision, nil
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const maxSlugLength = 60
+
+// transliterations maps lower case letters outside of ASCII to their usual
+// Latin spelling. Letters without an entry are dropped from slugs.
+var transliterations = map[rune]string{
+	// Latin-1 Supplement and Latin Extended-A
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĳ': "ij", 'ĵ': "j", 'ķ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n", 'ŋ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'œ': "oe", 'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+	// Greek
+	'α': "a", 'ά': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'έ': "e", 'ζ': "z", 'η': "i", 'ή': "i",
+	'θ': "th", 'ι': "i", 'ί': "i", 'ϊ': "i", 'ΐ': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'ό': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'ύ': "y", 'ϋ': "y",
+	'ΰ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o", 'ώ': "o",
+}
+
+// Slugify turns a title into a URL friendly slug made of lower case ASCII
+// letters, digits and single dashes, e.g. "Ünicode in Go!" -> "unicode-in-go".
+// The slug is cut at a word boundary to at most 60 bytes, and titles without
+// any usable letter give "blog".
+func Slugify(title string) string {
+	var sb strings.Builder
+
+	dash := false
+
+	for _, r := range strings.ToLower(title) {
+		var s string
+
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			s = string(r)
+		case r > unicode.MaxASCII:
+			s = transliterations[r]
+			if s == "" && unicode.Is(unicode.Mn, r) {
+				// combining marks, e.g. from a decomposed "é", are skipped
+				continue
+			}
+		}
+
+		if s == "" {
+			dash = sb.Len() > 0
+			continue
+		}
+
+		if dash {
+			sb.WriteByte('-')
+			dash = false
+		}
+
+		sb.WriteString(s)
+	}
+
+	slug := sb.String()
+
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+	}
+
+	if slug == "" {
+		return "blog"
+	}
+
+	return slug
+}
+
+// slugHasBase reports whether slug is base itself or base with a collision
+// suffix such as "-2".
+func slugHasBase(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+
+	suffix := strings.TrimPrefix(slug, base+"-")
+	if suffix == slug {
+		return false
+	}
+
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n > 1 && strconv.Itoa(n) == suffix
+}
+
+// pickSlug returns base if it is free, otherwise base with the lowest free
+// numeric suffix starting from 2. taken holds the slugs already in use.
+func pickSlug(base string, taken map[string]bool) string {
+	if !taken[base] {
+		return base
+	}
+
+	for i := 2; ; i++ {
+		slug := base + "-" + strconv.Itoa(i)
+		if !taken[slug] {
+			return slug
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package data
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "gRPC in Go!", want: "grpc-in-go"},
+		{title: "  Leading and trailing  ", want: "leading-and-trailing"},
+		{title: "Ünicode & Çağrı: İstanbul'da Şölen", want: "unicode-cagri-istanbul-da-solen"},
+		{title: "Straße nach Łódź", want: "strasse-nach-lodz"},
+		{title: "Привет, мир", want: "privet-mir"},
+		{title: "Café au lait", want: "cafe-au-lait"},
+		{title: "Go 1.18 -- generics", want: "go-1-18-generics"},
+		{title: "日本語", want: "blog"},
+		{title: "", want: "blog"},
+		{
+			title: "How to handle panics gracefully in Golang and keep your server alive",
+			want:  "how-to-handle-panics-gracefully-in-golang-and-keep-your",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := Slugify(tt.title); got != tt.want {
+				t.Errorf("Slug -> want: %q; got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPickSlug(t *testing.T) {
+	taken := map[string]bool{"grpc-in-go": true, "grpc-in-go-2": true}
+
+	if got := pickSlug("grpc-in-go", taken); got != "grpc-in-go-3" {
+		t.Errorf("Slug -> want: %q; got: %q", "grpc-in-go-3", got)
+	}
+
+	if got := pickSlug("rest-in-go", taken); got != "rest-in-go" {
+		t.Errorf("Slug -> want: %q; got: %q", "rest-in-go", got)
+	}
+}
+
+func TestSlugHasBase(t *testing.T) {
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{slug: "grpc-in-go", want: true},
+		{slug: "grpc-in-go-2", want: true},
+		{slug: "grpc-in-go-1", want: false},
+		{slug: "grpc-in-go-02", want: false},
+		{slug: "grpc-in-go-fast", want: false},
+		{slug: "grpc-in", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := slugHasBase(tt.slug, "grpc-in-go"); got != tt.want {
+			t.Errorf("slugHasBase(%q) -> want: %v; got: %v", tt.slug, tt.want, got)
+		}
+	}
+}
@@ -1,17 +1,16 @@
 package data
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"github.com/3n0ugh/BasedWeb/internal/validator"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
-// TODO: create user migration
-// TODO: Insert
-// TODO: GetByEmail
-// TODO: GetForToken
 // TODO: ValidateUser -> TODO: IsAnon check
 // TODO: ValidatePassword -> TODO: SetPass and MatchPass
 
@@ -92,5 +91,189 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+const insertUserQuery = `INSERT INTO users (name, email, password_hash, activated)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+func (u UserModel) Insert(ctx context.Context, user *User) error {
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	ctx, cancel := context.WithTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, insertUserQuery, args...).
+		Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		var pqErr *pq.Error
+
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key":
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register stores a new user, grants them the permission codes and creates
+// their activation token, in one transaction, so that a failed step leaves
+// no account behind.
+func (u UserModel) Register(ctx context.Context, user *User, ttl time.Duration, codes ...string) (*Token, error) {
+	token, err := generateToken(0, ttl, ScopeActivation)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	err = tx.QueryRowContext(ctx, insertUserQuery, args...).
+		Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		var pqErr *pq.Error
+
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key":
+			return nil, ErrDuplicateEmail
+		default:
+			return nil, err
+		}
+	}
+
+	query := `INSERT INTO users_permissions
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+
+	token.UserID = user.ID
+
+	query = `INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, tx.Commit()
+}
+
+func (u UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `SELECT id, created_at, name, email, password_hash, activated, version
+		FROM users
+		WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var user User
+
+	err := u.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetForToken returns the user owning a non-expired token of the given scope.
+func (u UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT users.id, users.created_at, users.name, users.email,
+		users.password_hash, users.activated, users.version
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var user User
+
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (u UserModel) Update(ctx context.Context, user *User) error {
+	query := `UPDATE users
+		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []interface{}{
+		user.Name,
+		user.Email,
+		user.Password.hash,
+		user.Activated,
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		var pqErr *pq.Error
+
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key":
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,176 @@
+// Package diff computes line-level differences between two texts with
+// Myers' O(ND) algorithm.
+package diff
+
+import "strings"
+
+type Op string
+
+const (
+	Equal  Op = "="
+	Insert Op = "+"
+	Delete Op = "-"
+)
+
+// Line is one line of an edit script turning the old text into the new one.
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Text splits both texts into lines and returns the edit script between them.
+func Text(a, b string) []Line {
+	return Lines(splitLines(a), splitLines(b))
+}
+
+// Lines returns the shortest edit script turning a into b.
+func Lines(a, b []string) []Line {
+	// The common prefix and suffix are always equal lines, and trimming
+	// them keeps the search below small for typical edits.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	script := make([]Line, 0, len(a)+len(b))
+
+	for _, l := range a[:prefix] {
+		script = append(script, Line{Op: Equal, Text: l})
+	}
+
+	script = append(script, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, l := range a[len(a)-suffix:] {
+		script = append(script, Line{Op: Equal, Text: l})
+	}
+
+	return script
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// maxEdits bounds the edit distance myers searches for. The snapshots it
+// keeps grow with the square of the distance, so texts further apart than
+// that are shown as replaced as a whole instead.
+const maxEdits = 1000
+
+// myers finds the shortest edit script by exploring diagonals k = x - y.
+// After each step d it keeps a snapshot of the furthest x reached on every
+// diagonal in [-(d+1), d+1], which is all the backtracking needs.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	var trace [][]int
+
+	for d := 0; d <= n+m; d++ {
+		if d > maxEdits {
+			return replace(a, b)
+		}
+
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	return nil
+}
+
+// replace returns the edit script deleting every line of a, then inserting
+// every line of b.
+func replace(a, b []string) []Line {
+	script := make([]Line, 0, len(a)+len(b))
+
+	for _, l := range a {
+		script = append(script, Line{Op: Delete, Text: l})
+	}
+
+	for _, l := range b {
+		script = append(script, Line{Op: Insert, Text: l})
+	}
+
+	return script
+}
+
+func backtrack(trace [][]int, a, b []string) []Line {
+	x, y := len(a), len(b)
+
+	var script []Line
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			script = append(script, Line{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				script = append(script, Line{Op: Insert, Text: b[y-1]})
+				y--
+			} else {
+				script = append(script, Line{Op: Delete, Text: a[x-1]})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+
+	return script
+}
@@ -0,0 +1,89 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []Line
+	}{
+		{name: "Both Empty", a: "", b: "", want: []Line{}},
+		{name: "Equal", a: "a\nb", b: "a\nb", want: []Line{{Equal, "a"}, {Equal, "b"}}},
+		{name: "Insert All", a: "", b: "a\nb", want: []Line{{Insert, "a"}, {Insert, "b"}}},
+		{name: "Delete All", a: "a\nb", b: "", want: []Line{{Delete, "a"}, {Delete, "b"}}},
+		{
+			name: "Change Middle Line",
+			a:    "gRPC\nin\nGo",
+			b:    "gRPC\nwith\nGo",
+			want: []Line{{Equal, "gRPC"}, {Delete, "in"}, {Insert, "with"}, {Equal, "Go"}},
+		},
+		{
+			name: "Myers Paper Example",
+			a:    "A\nB\nC\nA\nB\nB\nA",
+			b:    "C\nB\nA\nB\nA\nC",
+			want: []Line{
+				{Delete, "A"}, {Delete, "B"}, {Equal, "C"}, {Insert, "B"}, {Equal, "A"},
+				{Equal, "B"}, {Delete, "B"}, {Equal, "A"}, {Insert, "C"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Text(tt.a, tt.b)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Script -> want: %v; got: %v", tt.want, got)
+			}
+
+			// Applying the script must give back both texts.
+			var oldLines, newLines []string
+			for _, l := range got {
+				if l.Op != Insert {
+					oldLines = append(oldLines, l.Text)
+				}
+				if l.Op != Delete {
+					newLines = append(newLines, l.Text)
+				}
+			}
+
+			if strings.Join(oldLines, "\n") != tt.a || strings.Join(newLines, "\n") != tt.b {
+				t.Errorf("Script does not turn %q into %q", tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestTextFarApart(t *testing.T) {
+	// 100 000 bytes of distinct lines on each side, the most a blog body
+	// holds, with no line in common.
+	var a, b strings.Builder
+	for i := 0; a.Len() < 100_000; i++ {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	got := Text(a.String(), b.String())
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("Allocated -> want at most 64 MiB; got: %d MiB", allocated>>20)
+	}
+
+	want := replace(splitLines(a.String()), splitLines(b.String()))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Script -> want every old line deleted and every new one inserted")
+	}
+}
@@ -0,0 +1,453 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned when a "test" operation doesn't match the document.
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation is a single RFC 6902 operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is an RFC 6902 JSON Patch document.
+type Patch []Operation
+
+// DecodePatch parses a JSON Patch document and checks that every operation
+// has the members its op requires.
+func DecodePatch(buf []byte) (Patch, error) {
+	var p Patch
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON patch document: %w", err)
+	}
+
+	for i, op := range p {
+		switch op.Op {
+		case "add", "replace", "test":
+			if len(op.Value) == 0 {
+				return nil, fmt.Errorf("operation %d (%s) is missing \"value\"", i, op.Op)
+			}
+		case "move", "copy":
+			if op.From == "" {
+				return nil, fmt.Errorf("operation %d (%s) is missing \"from\"", i, op.Op)
+			}
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d has unknown op %q", i, op.Op)
+		}
+
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Apply applies the operations in order to doc and returns the patched
+// document. The patch is atomic: if any operation fails, an error is
+// returned and doc is left untouched.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	node, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range p {
+		node, err = op.apply(node)
+		if err != nil {
+			if errors.Is(err, ErrTestFailed) {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(node)
+}
+
+func (op Operation) apply(node interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+
+	case "remove":
+		node, _, err = remove(node, path)
+		return node, err
+
+	case "replace":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := get(node, path); err != nil {
+			return nil, err
+		}
+		node, _, err = remove(node, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+
+	case "move":
+		from, _ := parsePointer(op.From)
+		if isProperPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		node, value, err := remove(node, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, value)
+
+	case "copy":
+		from, _ := parsePointer(op.From)
+		value, err := get(node, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(node, path, deepCopy(value))
+
+	case "test":
+		want, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(node, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(got, want) {
+			return nil, fmt.Errorf("%w: value at %q is not %s", ErrTestFailed, op.Path, op.Value)
+		}
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc: members of the patch
+// object replace those of the document, null members remove them, and any
+// non-object patch replaces the whole document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON merge patch document: %w", err)
+	}
+
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+
+	return t
+}
+
+// decode parses a single JSON value, keeping numbers as json.Number so they
+// round-trip without losing precision.
+func decode(buf []byte) (interface{}, error) {
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, errors.New("body must only contain a single JSON value")
+	}
+
+	return v, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+
+	return tokens, nil
+}
+
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// arrayIndex parses an array index token. The index may be equal to length
+// only when allowEnd is set, which is how "add" appends.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	if i > length || (i == length && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+
+	return i, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+		}
+	}
+
+	return node, nil
+}
+
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, last := path[0], len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			n[token] = value
+			return n, nil
+		}
+
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+
+	case []interface{}:
+		i, err := arrayIndex(token, len(n), last)
+		if err != nil {
+			return nil, err
+		}
+
+		if last {
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+
+		child, err := add(n[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+}
+
+// remove deletes the value at path and returns the new node along with the
+// removed value.
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+
+	token, last := path[0], len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", token)
+		}
+
+		if last {
+			delete(n, token)
+			return n, child, nil
+		}
+
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+
+	case []interface{}:
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if last {
+			removed := n[i]
+			return append(n[:i:i], n[i+1:]...), removed, nil
+		}
+
+		child, removed, err := remove(n[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+
+	return nil, nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, child := range n {
+			m[k] = deepCopy(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, child := range n {
+			s[i] = deepCopy(child)
+		}
+		return s
+	}
+	return v
+}
+
+// equal compares two decoded JSON values the way RFC 6902 "test" does:
+// numbers by value, objects regardless of member order.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		xf, errX := x.Float64()
+		yf, errY := y.Float64()
+		return errX == nil && errY == nil && xf == yf
+	}
+	return a == b
+}
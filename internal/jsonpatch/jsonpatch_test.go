@@ -0,0 +1,160 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPatchApply(t *testing.T) {
+	doc := `{"title":"gRPC in Go!","category":["Golang","Network"]}`
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Add Appends With Dash",
+			patch: `[{"op":"add","path":"/category/-","value":"RPC"}]`,
+			want:  `{"category":["Golang","Network","RPC"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:  "Add Inserts At Index",
+			patch: `[{"op":"add","path":"/category/0","value":"RPC"}]`,
+			want:  `{"category":["RPC","Golang","Network"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:  "Remove Array Element",
+			patch: `[{"op":"remove","path":"/category/0"}]`,
+			want:  `{"category":["Network"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:  "Replace Member",
+			patch: `[{"op":"replace","path":"/title","value":"gRPC in Golang!"}]`,
+			want:  `{"category":["Golang","Network"],"title":"gRPC in Golang!"}`,
+		},
+		{
+			name: "Test Then Replace",
+			patch: `[{"op":"test","path":"/category/1","value":"Network"},
+				{"op":"replace","path":"/category/1","value":"Networking"}]`,
+			want: `{"category":["Golang","Networking"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:  "Move",
+			patch: `[{"op":"move","from":"/category/0","path":"/category/-"}]`,
+			want:  `{"category":["Network","Golang"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:  "Copy",
+			patch: `[{"op":"copy","from":"/title","path":"/body"}]`,
+			want:  `{"body":"gRPC in Go!","category":["Golang","Network"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:    "Failed Test",
+			patch:   `[{"op":"test","path":"/title","value":"REST"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:    "Remove Past The End",
+			patch:   `[{"op":"remove","path":"/category/-"}]`,
+			wantErr: errAny,
+		},
+		{
+			name:    "Replace Missing Member",
+			patch:   `[{"op":"replace","path":"/body","value":"x"}]`,
+			wantErr: errAny,
+		},
+		{
+			name:    "Leading Zero Index",
+			patch:   `[{"op":"add","path":"/category/01","value":"x"}]`,
+			wantErr: errAny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DecodePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := p.Apply([]byte(doc))
+
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("Error -> want: %v; got: nil", tt.wantErr)
+				}
+				if tt.wantErr != errAny && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Error -> want: %v; got: %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("Document -> want: %s; got: %s", tt.want, got)
+			}
+		})
+	}
+}
+
+var errAny = errors.New("any error")
+
+func TestDecodePatch(t *testing.T) {
+	tests := []string{
+		`{"op":"add","path":"/title","value":"x"}`,
+		`[{"op":"add","path":"/title"}]`,
+		`[{"op":"fly","path":"/title"}]`,
+		`[{"op":"remove","path":"title"}]`,
+		`[{"op":"move","path":"/title"}]`,
+	}
+
+	for _, tt := range tests {
+		if _, err := DecodePatch([]byte(tt)); err == nil {
+			t.Errorf("DecodePatch(%s) -> want: error; got: nil", tt)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	doc := `{"title":"gRPC in Go!","body":"soon","category":["Golang","Network"]}`
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{
+			name:  "Replace Member",
+			patch: `{"title":"gRPC in Golang!"}`,
+			want:  `{"body":"soon","category":["Golang","Network"],"title":"gRPC in Golang!"}`,
+		},
+		{
+			name:  "Replace Whole Array",
+			patch: `{"category":["RPC"]}`,
+			want:  `{"body":"soon","category":["RPC"],"title":"gRPC in Go!"}`,
+		},
+		{
+			name:  "Null Removes",
+			patch: `{"body":null}`,
+			want:  `{"category":["Golang","Network"],"title":"gRPC in Go!"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("Document -> want: %s; got: %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SMTPBackend delivers messages through an SMTP server, upgrading the
+// connection with STARTTLS when the server supports it.
+type SMTPBackend struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+func (b SMTPBackend) Send(from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(b.Host, strconv.Itoa(b.Port))
+
+	timeout := b.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, b.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: b.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", b.Username, b.Password, b.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+
+	for _, rcpt := range to {
+		err = c.Rcpt(rcpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// FileBackend writes every message as an .eml file into Dir instead of
+// delivering it. It is meant for local development and tests.
+type FileBackend struct {
+	Dir string
+}
+
+func (b FileBackend) Send(from string, to []string, msg []byte) error {
+	err := os.MkdirAll(b.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	randomBytes := make([]byte, 4)
+
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"),
+		hex.EncodeToString(randomBytes))
+
+	return os.WriteFile(filepath.Join(b.Dir, name), msg, 0o644)
+}
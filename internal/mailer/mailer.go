@@ -0,0 +1,203 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	ttemplate "text/template"
+	"time"
+)
+
+// templateFS holds the email templates. Each template file defines a
+// "subject", a "plainBody" and an "htmlBody" template.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// Backend delivers an already rendered RFC 5322 message.
+type Backend interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+type Mailer struct {
+	backend  Backend
+	sender   string
+	attempts int
+	backoff  time.Duration
+}
+
+// New returns a Mailer that delivers through the backend. A failed delivery
+// is tried up to 3 times in all, doubling the wait between attempts.
+func New(backend Backend, sender string) Mailer {
+	return Mailer{
+		backend:  backend,
+		sender:   sender,
+		attempts: 3,
+		backoff:  500 * time.Millisecond,
+	}
+}
+
+// Send renders the named template with the dynamic data and delivers the
+// resulting email to the recipient.
+func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
+	subject, plainBody, htmlBody, err := render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := m.compose(recipient, subject, plainBody, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return err
+	}
+
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return err
+	}
+
+	backoff := m.backoff
+
+	for i := 1; i <= m.attempts; i++ {
+		err = m.backend.Send(from.Address, []string{to.Address}, msg)
+		if err == nil {
+			return nil
+		}
+
+		if i < m.attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("mailer: sending failed after %d attempts: %w", m.attempts, err)
+}
+
+// render executes the subject and plain-text parts with text/template and the
+// HTML part with html/template, so only the HTML part is escaped.
+func render(templateFile string, data interface{}) (string, string, string, error) {
+	tmpl, err := ttemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	htmlTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return subject.String(), plainBody.String(), htmlBody.String(), nil
+}
+
+// compose builds a multipart/alternative message holding the plain-text and
+// HTML bodies.
+func (m Mailer) compose(recipient, subject, plainBody, htmlBody string) ([]byte, error) {
+	msg := new(bytes.Buffer)
+	body := new(bytes.Buffer)
+
+	mw := multipart.NewWriter(body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", plainBody},
+		{"text/html; charset=UTF-8", htmlBody},
+	}
+
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+
+		_, err = io.WriteString(qw, p.content)
+		if err != nil {
+			return nil, err
+		}
+
+		err = qw.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []struct {
+		key   string
+		value string
+	}{
+		{"From", m.sender},
+		{"To", recipient},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", mw.Boundary())},
+	}
+
+	for _, h := range headers {
+		fmt.Fprintf(msg, "%s: %s\r\n", h.key, h.value)
+	}
+
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func newMessageID() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("<%s@basedweb>", hex.EncodeToString(randomBytes)), nil
+}
@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type flakyBackend struct {
+	failures int
+	calls    int
+}
+
+func (b *flakyBackend) Send(from string, to []string, msg []byte) error {
+	b.calls++
+	if b.calls <= b.failures {
+		return errors.New("temporary failure")
+	}
+	return nil
+}
+
+func TestSendFileBackend(t *testing.T) {
+	dir := t.TempDir()
+
+	m := New(FileBackend{Dir: dir}, "BasedWeb <no-reply@basedweb.local>")
+
+	err := m.Send("gopher@example.com", "user_welcome.tmpl", map[string]interface{}{
+		"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"name":            "Gopher <3",
+		"userID":          7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("Files -> want: 1; got: %d", len(files))
+	}
+
+	msg, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"To: gopher@example.com",
+		"Subject: Welcome to BasedWeb!",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Type: text/html; charset=UTF-8",
+		"Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"Hi Gopher <3,",
+		"Hi Gopher &lt;3,",
+	} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("Message -> want to contain %q", want)
+		}
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "First Attempt", failures: 0, wantCalls: 1},
+		{name: "Last Attempt", failures: 2, wantCalls: 3},
+		{name: "All Attempts Fail", failures: 3, wantCalls: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &flakyBackend{failures: tt.failures}
+
+			m := New(backend, "no-reply@basedweb.local")
+			m.backoff = 0
+
+			err := m.Send("gopher@example.com", "token_password_reset.tmpl", map[string]interface{}{
+				"passwordResetToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Error -> want: %v; got: %v", tt.wantErr, err)
+			}
+
+			if backend.calls != tt.wantCalls {
+				t.Errorf("Calls -> want: %d; got: %d", tt.wantCalls, backend.calls)
+			}
+		})
+	}
+}
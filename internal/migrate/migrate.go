@@ -0,0 +1,614 @@
+// Package migrate applies the SQL migrations of the database schema and
+// keeps track of them in the schema_migrations table, along with a checksum
+// of every applied file to notice migrations edited after they were applied.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrModified       = errors.New("applied migration was modified")
+	ErrSchemaBehind   = errors.New("database schema is behind the migrations")
+	// ErrDirty is returned when the table left by the external migrate
+	// tool records a failed migration. The schema has to be repaired by
+	// hand and its version set with Force.
+	ErrDirty = errors.New("database schema is dirty")
+)
+
+// lockID is the key of the advisory lock held while migrating, so that two
+// migrators never run at the same time.
+const lockID = 8_421_337_001
+
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered change of the schema and the SQL undoing it.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Load reads the migrations from the NNNNNN_name.up.sql and
+// NNNNNN_name.down.sql files at the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		m := fileRX.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if m[3] == "up" {
+			sum := sha256.Sum256(content)
+			migration.Up = string(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Status is a migration and whether it was applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	// Modified is set when the applied file differs from the current one.
+	Modified bool
+}
+
+// applied is a row of the schema_migrations table.
+type applied struct {
+	Version   int64
+	Checksum  string
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *jsonlog.Logger
+}
+
+// New returns a Migrator applying the migrations to db and logging every
+// step to logger.
+func New(db *sql.DB, migrations []Migration, logger *jsonlog.Logger) *Migrator {
+	return &Migrator{db: db, migrations: migrations, logger: logger}
+}
+
+// Version returns the latest known migration version, which the schema is
+// at once every migration is applied.
+func (m *Migrator) Version() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists every known migration, and the applied ones that are no
+// longer known, by version. It only reads the schema_migrations table: when
+// it doesn't exist yet every migration is pending, and when it is still the
+// one of the external migrate tool ErrSchemaBehind is returned, as only the
+// migrate subcommand adopts it.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	state, err := readTableState(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	switch state {
+	case tableMissing:
+		return status(m.migrations, nil), nil
+	case tableLegacy:
+		return nil, fmt.Errorf("%w: schema_migrations was left by the migrate tool", ErrSchemaBehind)
+	}
+
+	rows, err := readApplied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return status(m.migrations, rows), nil
+}
+
+// Check returns ErrModified when an applied migration was changed since, and
+// ErrSchemaBehind when migrations are waiting to be applied or the
+// schema_migrations table has yet to be created or adopted. Like Status, it
+// never changes the database.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+
+	for _, s := range statuses {
+		switch {
+		case s.Modified:
+			return fmt.Errorf("%w: %d_%s", ErrModified, s.Version, s.Name)
+		case s.AppliedAt == nil:
+			pending++
+		}
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%w: %d pending", ErrSchemaBehind, pending)
+	}
+
+	return nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Version())
+}
+
+// Down rolls the latest n applied migrations back.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid number of migrations to roll back: %d", n)
+	}
+
+	return m.withLock(ctx, false, func(conn *sql.Conn, rows []applied) error {
+		if n > len(rows) {
+			n = len(rows)
+		}
+
+		for i := len(rows) - 1; i >= len(rows)-n; i-- {
+			err := m.down(ctx, conn, rows[i].Version)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Goto applies or rolls back migrations until the schema is at the given
+// version. Version 0 rolls every migration back.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, false, func(conn *sql.Conn, rows []applied) error {
+		up, down := plan(m.migrations, rows, version)
+
+		for _, s := range status(m.migrations, rows) {
+			if s.Modified && s.Version <= version {
+				return fmt.Errorf("%w: %d_%s", ErrModified, s.Version, s.Name)
+			}
+		}
+
+		for _, v := range down {
+			err := m.down(ctx, conn, v)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, v := range up {
+			err := m.up(ctx, conn, v)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Force records the schema as being at the given version without running any
+// migration: the migrations up to it are marked as applied with their current
+// checksums, and the later ones as not applied. It is the way out after
+// fixing the schema by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, true, func(conn *sql.Conn, rows []applied) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+
+			err = record(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		m.logger.PrintInfo("forced migration version", map[string]string{
+			"version": strconv.FormatInt(version, 10),
+		})
+
+		return nil
+	})
+}
+
+// plan returns the versions to roll back, newest first, and then the ones to
+// apply, oldest first, to bring the schema to the target version.
+func plan(migrations []Migration, rows []applied, target int64) (up []int64, down []int64) {
+	isApplied := make(map[int64]bool)
+
+	for i := len(rows) - 1; i >= 0; i-- {
+		isApplied[rows[i].Version] = true
+		if rows[i].Version > target {
+			down = append(down, rows[i].Version)
+		}
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= target && !isApplied[migration.Version] {
+			up = append(up, migration.Version)
+		}
+	}
+
+	return up, down
+}
+
+func status(migrations []Migration, rows []applied) []Status {
+	byVersion := make(map[int64]applied)
+	for _, row := range rows {
+		byVersion[row.Version] = row
+	}
+
+	var statuses []Status
+
+	for _, migration := range migrations {
+		s := Status{Migration: migration}
+
+		if row, ok := byVersion[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			s.AppliedAt = &appliedAt
+			s.Modified = row.Checksum != migration.Checksum
+			delete(byVersion, migration.Version)
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	// Applied migrations whose files are gone can't be compared or rolled back.
+	for _, row := range byVersion {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: row.Version, Name: "(missing)"},
+			AppliedAt: &appliedAt,
+			Modified:  true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// up applies a migration and records it in the same transaction.
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, version int64) error {
+	migration := m.find(version)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, migration.Up)
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	err = record(ctx, tx, *migration)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.logger.PrintInfo("applied migration", map[string]string{
+		"version": strconv.FormatInt(migration.Version, 10),
+		"name":    migration.Name,
+	})
+
+	return nil
+}
+
+// down rolls a migration back and forgets it in the same transaction.
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, version int64) error {
+	migration := m.find(version)
+	if migration == nil {
+		return fmt.Errorf("%w: %d is applied, but its files are missing", ErrUnknownVersion, version)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, migration.Down)
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.logger.PrintInfo("rolled back migration", map[string]string{
+		"version": strconv.FormatInt(migration.Version, 10),
+		"name":    migration.Name,
+	})
+
+	return nil
+}
+
+func record(ctx context.Context, tx *sql.Tx, migration Migration) error {
+	query := `INSERT INTO schema_migrations (version, name, checksum)
+		VALUES ($1, $2, $3)`
+
+	_, err := tx.ExecContext(ctx, query, migration.Version, migration.Name, migration.Checksum)
+	return err
+}
+
+// withLock runs fn on a connection holding the migration lock, with the rows
+// of the schema_migrations table, which is created if needed.
+func (m *Migrator) withLock(ctx context.Context, force bool,
+	fn func(conn *sql.Conn, rows []applied) error) error {
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	err = m.prepareTable(ctx, conn, force)
+	if err != nil {
+		return err
+	}
+
+	rows, err := readApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, rows)
+}
+
+// queryer is the part of *sql.DB, *sql.Conn and *sql.Tx the table is read
+// through.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// The states of the schema_migrations table.
+const (
+	tableMissing = iota
+	tableLegacy
+	tableCurrent
+)
+
+// readTableState tells whether the schema_migrations table exists, and
+// whether it is the one of the external migrate tool, which has a dirty
+// column.
+func readTableState(ctx context.Context, q queryer) (int, error) {
+	query := `SELECT count(*), count(*) FILTER (WHERE column_name = 'dirty')
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+
+	var columns, dirty int
+
+	err := q.QueryRowContext(ctx, query).Scan(&columns, &dirty)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case columns == 0:
+		return tableMissing, nil
+	case dirty > 0:
+		return tableLegacy, nil
+	}
+
+	return tableCurrent, nil
+}
+
+// readApplied returns the rows of the schema_migrations table by version.
+func readApplied(ctx context.Context, q queryer) ([]applied, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, checksum, applied_at
+		FROM schema_migrations
+		ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applieds []applied
+
+	for rows.Next() {
+		var a applied
+
+		err = rows.Scan(&a.Version, &a.Checksum, &a.AppliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		applieds = append(applieds, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applieds, nil
+}
+
+// prepareTable creates the schema_migrations table. It is only run by the
+// commands changing the schema, under the migration lock. A table left by the
+// external migrate tool, which only holds the current version and a dirty
+// flag, is replaced, with the migrations up to that version recorded as
+// applied. A dirty one is only replaced when forcing a version.
+func (m *Migrator) prepareTable(ctx context.Context, conn *sql.Conn, force bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	state, err := readTableState(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	legacy := state == tableLegacy
+
+	var legacyVersion int64
+
+	if legacy {
+		var dirty bool
+
+		err = tx.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).
+			Scan(&legacyVersion, &dirty)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if dirty && !force {
+			return fmt.Errorf("%w at version %d", ErrDirty, legacyVersion)
+		}
+
+		_, err = tx.ExecContext(ctx, `DROP TABLE schema_migrations`)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW())`)
+	if err != nil {
+		return err
+	}
+
+	if legacy {
+		for _, migration := range m.migrations {
+			if migration.Version > legacyVersion {
+				break
+			}
+
+			err = record(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		m.logger.PrintInfo("adopted schema_migrations of the migrate tool", map[string]string{
+			"version": strconv.FormatInt(legacyVersion, 10),
+		})
+	}
+
+	return tx.Commit()
+}
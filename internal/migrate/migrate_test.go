@@ -0,0 +1,148 @@
+package migrate
+
+import (
+	"github.com/3n0ugh/BasedWeb/migrations"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []int64
+		wantErr bool
+	}{
+		{name: "Ordered By Version", fsys: fstest.MapFS{
+			"000002_add_index.up.sql":      {Data: []byte("CREATE INDEX")},
+			"000002_add_index.down.sql":    {Data: []byte("DROP INDEX")},
+			"000001_create_table.up.sql":   {Data: []byte("CREATE TABLE")},
+			"000001_create_table.down.sql": {Data: []byte("DROP TABLE")},
+			"migrations.go":                {Data: []byte("package migrations")},
+		}, want: []int64{1, 2}},
+		{name: "Missing Up File", fsys: fstest.MapFS{
+			"000001_create_table.down.sql": {Data: []byte("DROP TABLE")},
+		}, wantErr: true},
+		{name: "Two Names", fsys: fstest.MapFS{
+			"000001_create_table.up.sql":   {Data: []byte("CREATE TABLE")},
+			"000001_create_other.down.sql": {Data: []byte("DROP TABLE")},
+		}, wantErr: true},
+		{name: "Zero Version", fsys: fstest.MapFS{
+			"000000_create_table.up.sql": {Data: []byte("CREATE TABLE")},
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.fsys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Error -> want: %t; got: %v", tt.wantErr, err)
+			}
+
+			var got []int64
+			for _, m := range migrations {
+				got = append(got, m.Version)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Versions -> want: %v; got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	files, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range files {
+		if m.Version != int64(i+1) {
+			t.Errorf("want migration %d; got: %d_%s", i+1, m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("%d_%s has no down migration", m.Version, m.Name)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+
+	tests := []struct {
+		name     string
+		applied  []int64
+		target   int64
+		wantUp   []int64
+		wantDown []int64
+	}{
+		{name: "Up From Empty", target: 4, wantUp: []int64{1, 2, 3, 4}},
+		{name: "Up From Middle", applied: []int64{1, 2}, target: 4, wantUp: []int64{3, 4}},
+		{name: "Up To Date", applied: []int64{1, 2, 3, 4}, target: 4},
+		{name: "Down", applied: []int64{1, 2, 3, 4}, target: 2, wantDown: []int64{4, 3}},
+		{name: "Down To Zero", applied: []int64{1, 2}, target: 0, wantDown: []int64{2, 1}},
+		{name: "Fill Gap", applied: []int64{1, 3}, target: 3, wantUp: []int64{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []applied
+			for _, v := range tt.applied {
+				rows = append(rows, applied{Version: v})
+			}
+
+			up, down := plan(migrations, rows, tt.target)
+
+			if !reflect.DeepEqual(up, tt.wantUp) {
+				t.Errorf("Up -> want: %v; got: %v", tt.wantUp, up)
+			}
+
+			if !reflect.DeepEqual(down, tt.wantDown) {
+				t.Errorf("Down -> want: %v; got: %v", tt.wantDown, down)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "create_table", Checksum: "a"},
+		{Version: 2, Name: "add_index", Checksum: "b"},
+		{Version: 3, Name: "add_column", Checksum: "c"},
+	}
+
+	rows := []applied{
+		{Version: 1, Checksum: "a", AppliedAt: time.Now()},
+		{Version: 2, Checksum: "edited", AppliedAt: time.Now()},
+		{Version: 4, Checksum: "d", AppliedAt: time.Now()},
+	}
+
+	type result struct {
+		Version  int64
+		Applied  bool
+		Modified bool
+	}
+
+	want := []result{
+		{Version: 1, Applied: true},
+		{Version: 2, Applied: true, Modified: true},
+		{Version: 3},
+		{Version: 4, Applied: true, Modified: true},
+	}
+
+	var got []result
+	for _, s := range status(migrations, rows) {
+		got = append(got, result{Version: s.Version, Applied: s.AppliedAt != nil, Modified: s.Modified})
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v; got: %+v", want, got)
+	}
+}
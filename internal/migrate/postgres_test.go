@@ -0,0 +1,313 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/3n0ugh/BasedWeb/internal/jsonlog"
+	_ "github.com/lib/pq"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testSchema is the schema the migrator tests run in, so that they leave the
+// schema_migrations table of the database alone.
+const testSchema = "migrate_test"
+
+var testFiles = fstest.MapFS{
+	"000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id bigint)")},
+	"000001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+	"000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id bigint)")},
+	"000002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+	"000003_create_c.up.sql":   {Data: []byte("CREATE TABLE c (id bigint)")},
+	"000003_create_c.down.sql": {Data: []byte("DROP TABLE c")},
+}
+
+// openTestDB connects to the database BASEDWEB_TEST_DB_DSN points to, with
+// an emptied testSchema as the search path. It skips the test when the
+// variable isn't set.
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("BASEDWEB_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("BASEDWEB_TEST_DB_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	_, err = admin.Exec(`DROP SCHEMA IF EXISTS ` + testSchema + ` CASCADE; CREATE SCHEMA ` + testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q := u.Query()
+		q.Set("search_path", testSchema)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + testSchema
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB) *Migrator {
+	migrations, err := Load(testFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(db, migrations, jsonlog.New(io.Discard, jsonlog.LevelOff))
+}
+
+// appliedVersions returns the versions recorded in schema_migrations.
+func appliedVersions(t *testing.T, db *sql.DB) []int64 {
+	rows, err := readApplied(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int64
+	for _, row := range rows {
+		versions = append(versions, row.Version)
+	}
+
+	return versions
+}
+
+// tables returns the names of the tables in the test schema.
+func tables(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema()
+		ORDER BY table_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func TestPostgresMigrator(t *testing.T) {
+	db := openTestDB(t)
+	m := newTestMigrator(t, db)
+	ctx := context.Background()
+
+	err := m.Check(ctx)
+	if !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("Check -> want: %v; got: %v", ErrSchemaBehind, err)
+	}
+
+	if got := tables(t, db); got != nil {
+		t.Fatalf("Check -> want no table created; got: %v", got)
+	}
+
+	tests := []struct {
+		name        string
+		run         func() error
+		wantApplied []int64
+		wantTables  []string
+	}{
+		{name: "Up", run: func() error { return m.Up(ctx) },
+			wantApplied: []int64{1, 2, 3}, wantTables: []string{"a", "b", "c", "schema_migrations"}},
+		{name: "Down", run: func() error { return m.Down(ctx, 2) },
+			wantApplied: []int64{1}, wantTables: []string{"a", "schema_migrations"}},
+		{name: "Goto Later", run: func() error { return m.Goto(ctx, 2) },
+			wantApplied: []int64{1, 2}, wantTables: []string{"a", "b", "schema_migrations"}},
+		{name: "Goto Zero", run: func() error { return m.Goto(ctx, 0) },
+			wantTables: []string{"schema_migrations"}},
+		{name: "Force", run: func() error { return m.Force(ctx, 2) },
+			wantApplied: []int64{1, 2}, wantTables: []string{"schema_migrations"}},
+		{name: "Up After Force", run: func() error { return m.Up(ctx) },
+			wantApplied: []int64{1, 2, 3}, wantTables: []string{"c", "schema_migrations"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := appliedVersions(t, db); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("Applied -> want: %v; got: %v", tt.wantApplied, got)
+			}
+
+			if got := tables(t, db); !reflect.DeepEqual(got, tt.wantTables) {
+				t.Errorf("Tables -> want: %v; got: %v", tt.wantTables, got)
+			}
+		})
+	}
+
+	err = m.Check(ctx)
+	if err != nil {
+		t.Errorf("Check -> want: <nil>; got: %v", err)
+	}
+
+	_, err = db.Exec(`UPDATE schema_migrations SET checksum = 'edited' WHERE version = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Check(ctx)
+	if !errors.Is(err, ErrModified) {
+		t.Errorf("Check -> want: %v; got: %v", ErrModified, err)
+	}
+}
+
+func TestPostgresMigratorLock(t *testing.T) {
+	db := openTestDB(t)
+	m := newTestMigrator(t, db)
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	err = m.Up(timeoutCtx)
+	if err == nil {
+		t.Fatal("Up -> want an error while another migrator holds the lock")
+	}
+
+	if got := tables(t, db); got != nil {
+		t.Fatalf("Up -> want nothing migrated while locked; got: %v", got)
+	}
+
+	// Checking only reads, so it doesn't wait for the lock.
+	checkCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	err = m.Check(checkCtx)
+	if !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("Check -> want: %v; got: %v", ErrSchemaBehind, err)
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("Applied -> want: [1 2 3]; got: %v", got)
+	}
+}
+
+func TestPostgresMigratorAdopt(t *testing.T) {
+	tests := []struct {
+		name        string
+		dirty       bool
+		run         func(m *Migrator) error
+		wantErr     error
+		wantApplied []int64
+		wantTables  []string
+	}{
+		{name: "Clean", run: func(m *Migrator) error { return m.Up(context.Background()) },
+			wantApplied: []int64{1, 2, 3}, wantTables: []string{"a", "b", "c", "schema_migrations"}},
+		{name: "Dirty", dirty: true, run: func(m *Migrator) error { return m.Up(context.Background()) },
+			wantErr: ErrDirty, wantTables: []string{"a", "b", "schema_migrations"}},
+		{name: "Dirty Forced", dirty: true, run: func(m *Migrator) error { return m.Force(context.Background(), 2) },
+			wantApplied: []int64{1, 2}, wantTables: []string{"a", "b", "schema_migrations"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			m := newTestMigrator(t, db)
+
+			// The migrate tool applied the first two migrations.
+			_, err := db.Exec(`CREATE TABLE schema_migrations (version bigint PRIMARY KEY, dirty boolean NOT NULL);
+				CREATE TABLE a (id bigint);
+				CREATE TABLE b (id bigint)`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = db.Exec(`INSERT INTO schema_migrations (version, dirty) VALUES (2, $1)`, tt.dirty)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = m.Check(context.Background())
+			if !errors.Is(err, ErrSchemaBehind) {
+				t.Errorf("Check -> want: %v; got: %v", ErrSchemaBehind, err)
+			}
+
+			state, err := readTableState(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if state != tableLegacy {
+				t.Fatalf("Check -> want the legacy table left as is; got state: %d", state)
+			}
+
+			err = tt.run(m)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Error -> want: %v; got: %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr == nil {
+				if got := appliedVersions(t, db); !reflect.DeepEqual(got, tt.wantApplied) {
+					t.Errorf("Applied -> want: %v; got: %v", tt.wantApplied, got)
+				}
+			}
+
+			if got := tables(t, db); !reflect.DeepEqual(got, tt.wantTables) {
+				t.Errorf("Tables -> want: %v; got: %v", tt.wantTables, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE blogs ADD COLUMN IF NOT EXISTS author_id bigint REFERENCES users ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS blogs_author_id_idx ON blogs (author_id);
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS blog_revisions (
+    blog_id bigint NOT NULL REFERENCES blogs ON DELETE CASCADE,
+    version integer NOT NULL,
+    replaced_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    body text NOT NULL,
+    category text[] NOT NULL,
+    PRIMARY KEY (blog_id, version)
+);
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE blogs ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'published';
+ALTER TABLE blogs ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+ALTER TABLE blogs ALTER COLUMN status SET DEFAULT 'draft';
+ALTER TABLE blogs DROP CONSTRAINT IF EXISTS status_check;
+ALTER TABLE blogs DROP CONSTRAINT IF EXISTS publish_at_check;
+ALTER TABLE blogs ADD CONSTRAINT status_check CHECK
+    (status IN ('draft', 'scheduled', 'published', 'archived'));
+ALTER TABLE blogs ADD CONSTRAINT publish_at_check CHECK
+    (status <> 'scheduled' OR publish_at IS NOT NULL);
+CREATE INDEX IF NOT EXISTS blogs_scheduled_publish_at_idx ON blogs (publish_at)
+    WHERE status = 'scheduled';
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS blog_slugs;
+ALTER TABLE blogs DROP CONSTRAINT IF EXISTS blogs_slug_key;
+ALTER TABLE blogs DROP COLUMN IF EXISTS slug;
\ No newline at end of file
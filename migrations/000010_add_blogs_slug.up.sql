@@ -0,0 +1,14 @@
+ALTER TABLE blogs ADD COLUMN IF NOT EXISTS slug text;
+UPDATE blogs SET slug = trim(BOTH '-' FROM lower(regexp_replace(title, '[^a-zA-Z0-9]+', '-', 'g'))) || '-' || id
+    WHERE slug IS NULL;
+ALTER TABLE blogs ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE blogs DROP CONSTRAINT IF EXISTS blogs_slug_key;
+ALTER TABLE blogs ADD CONSTRAINT blogs_slug_key UNIQUE (slug);
+CREATE TABLE IF NOT EXISTS blog_slugs (
+    slug text PRIMARY KEY,
+    blog_id bigint NOT NULL REFERENCES blogs ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS blog_slugs_blog_id_idx ON blog_slugs (blog_id);
+INSERT INTO blog_slugs (slug, blog_id) SELECT slug, id FROM blogs
+    ON CONFLICT (slug) DO NOTHING;
\ No newline at end of file
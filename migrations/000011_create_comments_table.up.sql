@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS comments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    blog_id bigint NOT NULL REFERENCES blogs ON DELETE CASCADE,
+    parent_id bigint REFERENCES comments ON DELETE CASCADE,
+    author_id bigint REFERENCES users ON DELETE SET NULL,
+    body text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_body_length_check;
+ALTER TABLE comments ADD CONSTRAINT comments_body_length_check CHECK
+    (char_length(body) BETWEEN 1 AND 5000);
+CREATE INDEX IF NOT EXISTS comments_blog_id_parent_id_idx ON comments (blog_id, parent_id);
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id);
\ No newline at end of file
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code = 'comments:moderate';
+DROP INDEX IF EXISTS comments_ip_created_at_idx;
+DROP INDEX IF EXISTS comments_status_created_at_idx;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_status_check;
+ALTER TABLE comments DROP COLUMN IF EXISTS ip;
+ALTER TABLE comments DROP COLUMN IF EXISTS flags;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
\ No newline at end of file
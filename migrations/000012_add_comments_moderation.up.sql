@@ -0,0 +1,12 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'approved';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS flags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS ip text NOT NULL DEFAULT '';
+ALTER TABLE comments ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_status_check;
+ALTER TABLE comments ADD CONSTRAINT comments_status_check CHECK
+    (status IN ('pending', 'approved', 'spam'));
+CREATE INDEX IF NOT EXISTS comments_status_created_at_idx ON comments (status, created_at);
+CREATE INDEX IF NOT EXISTS comments_ip_created_at_idx ON comments (ip, created_at);
+INSERT INTO permissions (code)
+VALUES ('comments:moderate')
+ON CONFLICT (code) DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS blogs_search_english_idx;
+DROP INDEX IF EXISTS blogs_search_french_idx;
+DROP INDEX IF EXISTS blogs_search_german_idx;
+DROP INDEX IF EXISTS blogs_search_spanish_idx;
+DROP INDEX IF EXISTS blogs_search_turkish_idx;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE INDEX IF NOT EXISTS blogs_search_english_idx ON blogs USING GIN ((
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', body), 'B')
+));
+CREATE INDEX IF NOT EXISTS blogs_search_french_idx ON blogs USING GIN ((
+    setweight(to_tsvector('french', title), 'A') ||
+    setweight(to_tsvector('french', body), 'B')
+));
+CREATE INDEX IF NOT EXISTS blogs_search_german_idx ON blogs USING GIN ((
+    setweight(to_tsvector('german', title), 'A') ||
+    setweight(to_tsvector('german', body), 'B')
+));
+CREATE INDEX IF NOT EXISTS blogs_search_spanish_idx ON blogs USING GIN ((
+    setweight(to_tsvector('spanish', title), 'A') ||
+    setweight(to_tsvector('spanish', body), 'B')
+));
+CREATE INDEX IF NOT EXISTS blogs_search_turkish_idx ON blogs USING GIN ((
+    setweight(to_tsvector('turkish', title), 'A') ||
+    setweight(to_tsvector('turkish', body), 'B')
+));
\ No newline at end of file
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the database schema, so
+// they ship inside the binary.
+package migrations
+
+import "embed"
+
+// FS holds the NNNNNN_name.up.sql and NNNNNN_name.down.sql migration files.
+//
+//go:embed *.sql
+var FS embed.FS